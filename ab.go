@@ -44,6 +44,8 @@ type ABCore struct {
 	ctx           context.Context
 	cancel        context.CancelFunc
 	h             *httpClient
+	lastLoad      atomic.Int64 // unix ns of the last successful meta load
+	loadFailures  atomic.Uint64
 }
 
 // loadRemoteMeta fetches the AB metadata from the remote server.
@@ -55,6 +57,7 @@ func (abc *ABCore) loadRemoteMeta() {
 	abData, err := abc.abCfg.MetaLoader.LoadMeta()
 	if err != nil {
 		abc.logger.Errorf("[%s] ab core loadRemoteMeta failed: %v", abc.sourceToken, err)
+		abc.loadFailures.Add(1)
 		return
 	}
 
@@ -72,6 +75,7 @@ func (abc *ABCore) loadRemoteMeta() {
 
 	if !needupdate {
 		abc.logger.Debugf("[%s] ab core loadRemoteMeta from server without new info", abc.sourceToken)
+		abc.lastLoad.Store(time.Now().UnixNano())
 		return
 	}
 
@@ -88,6 +92,7 @@ func (abc *ABCore) loadRemoteMeta() {
 				value := make(map[string]any)
 				if err = json.Unmarshal(payload, &value); err != nil {
 					abc.logger.Errorf("[%s] ab core json.Unmarshal VariantPayload error: %v, payload:%s", abc.sourceToken, err, payload)
+					abc.loadFailures.Add(1)
 					return
 				}
 				if spec.VariantValues == nil {
@@ -101,6 +106,7 @@ func (abc *ABCore) loadRemoteMeta() {
 	}
 
 	abc.setStorage(&s)
+	abc.lastLoad.Store(time.Now().UnixNano())
 	abc.logger.Debugf("[%s] ab core ffLoadRemoteMeta from server: [%v]", abc.sourceToken, s)
 }
 
@@ -163,6 +169,7 @@ func NewABCore(endpoint, sourceToken string, config *Config, h *httpClient) (*AB
 			SourceToken:   abc.sourceToken,
 			ProjectSecret: abc.abCfg.ProjectSecret,
 			HTTPClient:    h,
+			RetryPolicy:   config.RetryPolicy,
 		}
 		abc.logger.Infof("ab core initialized with meta loader: [%v]", abc.abCfg.MetaLoader)
 	}
@@ -415,15 +422,26 @@ func (abc *ABCore) evalABGates(user User, spec *ABSpec, evalID string, index int
 	return false, nil
 }
 
+// getEvalID returns the ID of the unit spec randomises by, or "" if user has none,
+// in which case the spec is not evaluated.
 func (abc *ABCore) getEvalID(user User, spec *ABSpec) string {
 	switch {
 	case strings.EqualFold(spec.SubjectID, "anon_id"):
 		return user.AnonID
 	case strings.EqualFold(spec.SubjectID, "login_id"):
 		return user.LoginID
-	default:
-		return fmt.Sprintf("%v", user.ABUserProperties[spec.SubjectID])
 	}
+	if id, ok := user.CustomIDs[spec.SubjectID]; ok {
+		return id
+	}
+	if groupID, ok := user.Groups[spec.SubjectID]; ok {
+		return groupID // group-level randomisation, e.g. SubjectID "company_id"
+	}
+	// legacy: units passed as A/B properties
+	if v, ok := user.ABUserProperties[spec.SubjectID]; ok && v != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return ""
 }
 
 func (abc *ABCore) evalABSticky(spec *ABSpec, evalID string, result *ABResult) (handled bool, stickyDataKey string, err error) {
@@ -0,0 +1,28 @@
+package sensorswave
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalABSkipsMissingUnit(t *testing.T) {
+	abc := &ABCore{abCfg: &ABConfig{}}
+	spec := &ABSpec{ID: 1, Key: "exp", Enabled: true, Sticky: true, SubjectID: "device_id"}
+
+	// Without the unit the spec is skipped before the sticky handler is needed.
+	result, err := abc.evalAB(User{LoginID: "u1"}, spec, 0)
+	require.NoError(t, err)
+	require.Nil(t, result.VariantID)
+
+	_, err = abc.evalAB(User{LoginID: "u1"}.WithCustomID("device_id", "d-1"), spec, 0)
+	require.ErrorIs(t, err, ErrABWithoutSticky)
+}
+
+func TestValidateUserCustomIDs(t *testing.T) {
+	c := newImpressTestClient()
+	require.NoError(t, c.validateUser(User{LoginID: "u1"}.WithCustomID("device_id", "d-1")))
+	require.ErrorIs(t, c.validateUser(User{LoginID: "u1"}.WithCustomID("device_id", "")), ErrCustomIDInvalid)
+	require.ErrorIs(t, c.validateUser(User{LoginID: "u1"}.WithCustomID("", "d-1")), ErrCustomIDInvalid)
+	require.ErrorIs(t, c.validateUser(User{LoginID: "u1"}.WithCustomID("Login_ID", "x")), ErrCustomIDInvalid)
+}
@@ -0,0 +1,200 @@
+package sensorswave
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BatchError reports the items of a TrackBatch or ProfileBatch call that were not queued.
+type BatchError struct {
+	Errors []error // one entry per input item, nil for queued items
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	var first error
+	for _, err := range e.Errors {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d items failed, first: %v", failed, len(e.Errors), first)
+}
+
+// Unwrap returns the non-nil item errors, so errors.Is and errors.As match any of them.
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// newBatchError returns a *BatchError if any of errs is set, or nil.
+func newBatchError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// ProfileOperation is one user profile update for ProfileBatch.
+type ProfileOperation struct {
+	User           User
+	Type           string         // one of the UserSetType* constants
+	Properties     Properties     // values for UserSetTypeSet, UserSetTypeSetOnce and UserSetTypeIncrement
+	ListProperties ListProperties // values for UserSetTypeAppend and UserSetTypeUnion
+	Keys           []string       // keys for UserSetTypeUnset
+}
+
+// event builds the $UserSet event of the operation.
+func (op ProfileOperation) event() (Event, error) {
+	if op.User.AnonID == "" && op.User.LoginID == "" {
+		return Event{}, ErrEmptyUserIDs
+	}
+	userPropertyOpts, err := op.userPropertyOpts()
+	if err != nil {
+		return Event{}, err
+	}
+
+	event := NewEvent(op.User.AnonID, op.User.LoginID, PseUserSet).
+		WithUserPropertyOpts(userPropertyOpts).
+		WithProperties(NewProperties().Set(PspUserSetType, op.Type))
+	return event, nil
+}
+
+// userPropertyOpts builds the operator map of the operation.
+func (op ProfileOperation) userPropertyOpts() (UserPropertyOpts, error) {
+	userPropertyOpts := NewUserPropertyOpts()
+	switch op.Type {
+	case UserSetTypeSet:
+		for key, value := range op.Properties {
+			userPropertyOpts.Set(key, value)
+		}
+	case UserSetTypeSetOnce:
+		for key, value := range op.Properties {
+			userPropertyOpts.SetOnce(key, value)
+		}
+	case UserSetTypeIncrement:
+		for key, value := range op.Properties {
+			userPropertyOpts.Increment(key, value)
+		}
+	case UserSetTypeAppend:
+		for key, value := range op.ListProperties {
+			userPropertyOpts.Append(key, value)
+		}
+	case UserSetTypeUnion:
+		for key, value := range op.ListProperties {
+			userPropertyOpts.Union(key, value)
+		}
+	case UserSetTypeUnset:
+		for _, key := range op.Keys {
+			userPropertyOpts.Unset(key)
+		}
+	case UserSetTypeDelete:
+		userPropertyOpts.Delete()
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrProfileTypeInvalid, op.Type)
+	}
+	return userPropertyOpts, nil
+}
+
+func (c *client) TrackBatch(ctx context.Context, events []Event) error {
+	return c.trackBatch(ctx, events, make([]error, len(events)))
+}
+
+func (c *client) ProfileBatch(ctx context.Context, ops []ProfileOperation) error {
+	events := make([]Event, len(ops))
+	errs := make([]error, len(ops))
+	for i, op := range ops {
+		if errs[i] = c.validateUser(op.User); errs[i] == nil {
+			events[i], errs[i] = op.event()
+		}
+	}
+	return c.trackBatch(ctx, events, errs)
+}
+
+// trackBatch encodes the events without an error in errs and queues them in one step.
+func (c *client) trackBatch(ctx context.Context, events []Event, errs []error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	msgs := make([][]byte, 0, len(events))
+	queued := make([]int, 0, len(events))
+	for i := range events {
+		if errs[i] != nil {
+			continue
+		}
+		encoded, err := c.encode(ctx, events[i])
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if len(encoded) > 0 { // not dropped by an interceptor
+			msgs = append(msgs, encoded...)
+			queued = append(queued, i)
+		}
+	}
+
+	if len(msgs) > 0 {
+		if err := c.enqueueBulk(ctx, msgs); err != nil {
+			for _, i := range queued {
+				errs[i] = err
+			}
+		}
+	}
+	return newBatchError(errs)
+}
+
+// enqueueBulk hands msgs to the batching loop in one step, bypassing msgchan.
+// QueueBlock waits until ctx is done; the other policies wait up to EnqueueTimeout
+// and then drop the whole batch.
+func (c *client) enqueueBulk(ctx context.Context, msgs [][]byte) error {
+	var timeout <-chan time.Time
+	if c.cfg.QueuePolicy != QueueBlock {
+		timer := time.NewTimer(c.cfg.EnqueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	if c.pool != nil {
+		req := poolRequest{c: c, msgs: msgs, done: make(chan error, 1)}
+		select {
+		case c.pool.ctrl <- req:
+			if err := <-req.done; err != nil {
+				return err
+			}
+			c.stats.enqueued.Add(uint64(len(msgs)))
+			return nil
+		case <-c.quit:
+			return ErrClosed
+		case <-timeout:
+			c.dropped(uint64(len(msgs)))
+			return ErrTooManyRequests
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case c.bulkchan <- msgs:
+		c.stats.enqueued.Add(uint64(len(msgs)))
+		return nil
+	case <-c.quit:
+		return ErrClosed
+	case <-timeout:
+		c.dropped(uint64(len(msgs)))
+		return ErrTooManyRequests
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+package sensorswave
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]Event
+}
+
+// server records each request as a batch; an undecodable body is recorded as an empty one.
+func (r *batchRecorder) server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var events []Event
+		_ = json.NewDecoder(req.Body).Decode(&events)
+		r.mu.Lock()
+		r.batches = append(r.batches, events)
+		r.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func (r *batchRecorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sizes := make([]int, 0, len(r.batches))
+	for _, b := range r.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func TestTrackBatch(t *testing.T) {
+	rec := &batchRecorder{}
+	server := rec.server()
+	defer server.Close()
+
+	cfg := Config{Logger: &noopLogger{}, FlushInterval: time.Hour, MaxBatchSize: 50}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	events := make([]Event, 0, 122)
+	for i := 0; i < 120; i++ {
+		events = append(events, NewEvent("anon", "", fmt.Sprintf("Bulk%d", i)))
+	}
+	events = append(events, NewEvent("", "", "NoUser"), NewEvent("anon", "", strings.Repeat("a", 129)))
+
+	err = c.TrackBatch(context.Background(), events)
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Len(t, batchErr.Errors, 122)
+	for i := 0; i < 120; i++ {
+		require.NoError(t, batchErr.Errors[i])
+	}
+	require.ErrorIs(t, batchErr.Errors[120], ErrEmptyUserIDs)
+	require.ErrorIs(t, batchErr.Errors[121], ErrEventNameTooLong)
+	require.ErrorIs(t, err, ErrEmptyUserIDs)
+
+	require.NoError(t, c.Flush(context.Background()))
+	require.Equal(t, []int{50, 50, 20}, rec.sizes())
+	require.NoError(t, c.TrackBatch(context.Background(), events[:3]))
+}
+
+func TestProfileBatch(t *testing.T) {
+	rec := &batchRecorder{}
+	server := rec.server()
+	defer server.Close()
+
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), Config{Logger: &noopLogger{}, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	defer c.Close()
+
+	user := User{LoginID: "user-1"}
+	ops := []ProfileOperation{
+		{User: user, Type: UserSetTypeSet, Properties: Properties{"plan": "pro"}},
+		{User: user, Type: UserSetTypeUnion, ListProperties: ListProperties{"tags": {"a", "b"}}},
+		{User: user, Type: "user_bogus"},
+		{User: user, Type: UserSetTypeUnset, Keys: []string{"legacy"}},
+		{User: User{LoginID: "user-2", CustomIDs: map[string]string{"login_id": "x"}}, Type: UserSetTypeSet, Properties: Properties{"plan": "pro"}},
+	}
+	err = c.ProfileBatch(context.Background(), ops)
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.True(t, errors.Is(batchErr.Errors[2], ErrProfileTypeInvalid))
+	require.ErrorIs(t, batchErr.Errors[4], ErrCustomIDInvalid)
+	require.NoError(t, batchErr.Errors[0])
+	require.NoError(t, batchErr.Errors[3])
+
+	require.NoError(t, c.Flush(context.Background()))
+	require.Equal(t, []int{3}, rec.sizes())
+	got := rec.batches[0]
+	require.Equal(t, PseUserSet, got[0].Event)
+	require.Equal(t, UserSetTypeSet, got[0].Properties[PspUserSetType])
+	require.Equal(t, map[string]any{"plan": "pro"}, got[0].UserProperties["$set"])
+	require.Equal(t, UserSetTypeUnset, got[2].Properties[PspUserSetType])
+
+	require.ErrorIs(t, c.ProfileSet(ops[4].User, Properties{"plan": "pro"}), ErrCustomIDInvalid)
+}
+
+func TestTrackBatchAfterClose(t *testing.T) {
+	c, err := NewWithConfig(Endpoint("http://test.example.com"), SourceToken("test-token"), Config{Logger: &noopLogger{}})
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+
+	err = c.TrackBatch(context.Background(), []Event{NewEvent("anon", "", "A"), NewEvent("anon", "", "B")})
+	require.ErrorIs(t, err, ErrClosed)
+}
@@ -1,9 +1,12 @@
 package sensorswave
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // Client is the main interface for interacting with the SDK.
@@ -12,16 +15,39 @@ type Client interface {
 	// Close gracefully shuts down the client, flushing any pending events.
 	Close() error
 
+	// CloseContext is like Close but gives up waiting when ctx is done.
+	// In-flight requests and their retries are aborted at that point.
+	CloseContext(ctx context.Context) error
+
+	// Flush sends all queued events and waits for in-flight requests to finish.
+	Flush(ctx context.Context) error
+
 	// ========== User Identity ==========
 
 	// Identify links an anonymous ID with a login ID.
 	Identify(user User) error
 
+	// Alias records the anon→login link used by Config.Identity without sending an event.
+	Alias(user User) error
+
+	// Unlink removes the login ID linked to anonID from Config.Identity.
+	Unlink(anonID string) error
+
 	// ========== Event Tracking ==========
 
 	// TrackEvent tracks a custom event with properties.
 	TrackEvent(user User, event string, properties Properties) error
 
+	// TrackEventContext is like TrackEvent but stops waiting for queue room when ctx is done.
+	TrackEventContext(ctx context.Context, user User, event string, properties Properties) error
+
+	// RegisterSuperProperties adds properties sent with every event, e.g. service name or region.
+	// Properties set on an event, or returned by Config.PropertyProviders, take precedence.
+	RegisterSuperProperties(properties Properties) error
+
+	// UnregisterSuperProperty removes a property added by RegisterSuperProperties.
+	UnregisterSuperProperty(key string)
+
 	// ========== User Profile Operations ==========
 
 	// ProfileSet sets user profile properties ($set).
@@ -46,6 +72,35 @@ type Client interface {
 	// ProfileDelete deletes the entire user profile ($delete).
 	ProfileDelete(user User) error
 
+	// ProfileUpdate starts a builder that combines several profile operations for one user.
+	// Commit queues them as ordered $UserSet events, one per operation type.
+	ProfileUpdate(user User) *ProfileUpdateBuilder
+
+	// ========== Group Profile Operations ==========
+	// Groups are identified by a group key such as "company_id" and a group ID.
+	// Events of a User carry its memberships from User.Groups.
+
+	// GroupProfileSet sets group profile properties ($set).
+	GroupProfileSet(groupKey, groupID string, properties Properties) error
+
+	// GroupProfileSetOnce sets group profile properties only if they don't already exist ($set_once).
+	GroupProfileSetOnce(groupKey, groupID string, properties Properties) error
+
+	// GroupProfileIncrement increments numeric group profile properties ($increment).
+	GroupProfileIncrement(groupKey, groupID string, properties Properties) error
+
+	// GroupProfileAppend appends values to list group profile properties ($append).
+	GroupProfileAppend(groupKey, groupID string, properties ListProperties) error
+
+	// GroupProfileUnion adds unique values to list group profile properties ($union).
+	GroupProfileUnion(groupKey, groupID string, properties ListProperties) error
+
+	// GroupProfileUnset removes group profile properties ($unset).
+	GroupProfileUnset(groupKey, groupID string, propertyKeys ...string) error
+
+	// GroupProfileDelete deletes the entire group profile ($delete).
+	GroupProfileDelete(groupKey, groupID string) error
+
 	// ========== A/B Testing ==========
 
 	// CheckFeatureGate evaluates a feature gate and returns whether it passes.
@@ -63,11 +118,29 @@ type Client interface {
 	// GetABSpecs exports the current A/B testing state for faster startup in future sessions.
 	GetABSpecs() ([]byte, error)
 
+	// ========== Diagnostics ==========
+
+	// DroppedEvents returns the number of events discarded by the QueuePolicy since the client was created.
+	DroppedEvents() uint64
+
+	// Stats returns the counters and gauges of the tracking pipeline and the A/B metadata.
+	Stats() Stats
+
 	// ========== Low-level API ==========
 
 	// Track submits a fully populated Event structure directly.
 	// Use this for advanced scenarios; prefer TrackEvent for normal usage.
 	Track(event Event) error
+
+	// TrackContext is like Track but stops waiting for queue room when ctx is done.
+	TrackContext(ctx context.Context, event Event) error
+
+	// TrackBatch validates all events up front and queues the valid ones together.
+	// It returns a *BatchError with one entry per event if any of them was not queued.
+	TrackBatch(ctx context.Context, events []Event) error
+
+	// ProfileBatch is TrackBatch for user profile operations.
+	ProfileBatch(ctx context.Context, ops []ProfileOperation) error
 }
 
 var _ Client = (*client)(nil)
@@ -79,6 +152,16 @@ func New(endpoint Endpoint, token SourceToken) (Client, error) {
 
 // NewWithConfig creates a new SDK Client with the specified configuration.
 func NewWithConfig(endpoint Endpoint, token SourceToken, cfg Config) (Client, error) {
+	c, err := newClient(endpoint, token, cfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient creates a client. If pool is set, the client uses the pool's HTTP
+// client, concurrency limit, batching worker and meta refresh loop instead of its own.
+func newClient(endpoint Endpoint, token SourceToken, cfg Config, pool *Pool) (*client, error) {
 	// Normalize configuration and apply defaults
 	normalizeConfig(&cfg)
 	normalizedEndpoint, err := normalizeEndpoint(string(endpoint))
@@ -87,23 +170,96 @@ func NewWithConfig(endpoint Endpoint, token SourceToken, cfg Config) (Client, er
 		return nil, err
 	}
 	if normalizedEndpoint == "" {
-		if cfg.AB == nil || (cfg.AB.MetaLoader == nil && cfg.AB.MetaEndpoint == "") {
+		if len(cfg.Sinks) == 0 && cfg.Export == nil && (cfg.AB == nil || (cfg.AB.MetaLoader == nil && cfg.AB.MetaEndpoint == "")) {
 			return nil, fmt.Errorf("endpoint is required")
 		}
-		cfg.Logger.Warnf("endpoint is empty; tracking is disabled")
+		if len(cfg.Sinks) == 0 && cfg.Export == nil {
+			cfg.Logger.Warnf("endpoint is empty; tracking is disabled")
+		}
+	}
+	for i, sc := range cfg.Sinks {
+		if (sc.Sink == nil) == (sc.NewSink == nil) {
+			return nil, fmt.Errorf("sink %d: exactly one of Sink and NewSink must be set", i)
+		}
+	}
+	if cfg.SignTrackRequests && cfg.ProjectSecret == "" {
+		return nil, fmt.Errorf("project secret is required when SignTrackRequests is set")
+	}
+	var export *fileSink
+	if cfg.Export != nil {
+		if export, err = newFileSink(*cfg.Export); err != nil {
+			cfg.Logger.Errorf("export init error: %v", err)
+			return nil, err
+		}
+	}
+	var rd *redactor
+	if cfg.Redaction != nil {
+		var err error
+		if rd, err = newRedactor(*cfg.Redaction); err != nil {
+			return nil, err
+		}
 	}
 
 	c := &client{
 		endpoint:    normalizedEndpoint,
 		sourceToken: string(token),
 		cfg:         &cfg,
-		h:           NewHTTPClient(cfg.Transport),
+		pool:        pool,
+		redactor:    rd,
 		quit:        make(chan struct{}),
-		msgchan:     make(chan []byte, maxEventChanSize),
-		sem:         make(chan struct{}, cfg.HTTPConcurrency),
+		msgchan:     make(chan []byte, cfg.MaxQueueSize),
 	}
-	for i := 0; i < cfg.HTTPConcurrency; i++ {
-		c.sem <- struct{}{}
+	c.providerStuck = make([]atomic.Int32, len(cfg.PropertyProviders))
+	if pool != nil {
+		c.h = pool.h
+		c.sem = pool.sem
+	} else {
+		c.h = NewHTTPClientWithDoer(cfg.Transport, cfg.HTTPDoer)
+		c.flushReq = make(chan chan struct{})
+		c.bulkchan = make(chan [][]byte)
+		c.sem = make(chan struct{}, cfg.HTTPConcurrency)
+		for i := 0; i < cfg.HTTPConcurrency; i++ {
+			c.sem <- struct{}{}
+		}
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	if cfg.Identity != nil {
+		c.identity = newIdentityResolver(*cfg.Identity, cfg.Logger)
+	}
+
+	if cfg.Spool != nil && c.endpoint != "" && export == nil {
+		sp, err := openSpool(*cfg.Spool, cfg.Logger)
+		if err != nil {
+			cfg.Logger.Errorf("spool open error: %v", err)
+			return nil, err
+		}
+		c.spool = sp
+	}
+
+	// Sinks from NewSink belong to the client; a Pool closes its shared ones itself
+	sinks := make([]SinkConfig, len(cfg.Sinks))
+	owned := make([]bool, len(cfg.Sinks))
+	abort := func() {
+		c.cancel()
+		if c.spool != nil {
+			_ = c.spool.close()
+		}
+		for i, sc := range sinks {
+			if owned[i] && sc.Sink != nil {
+				_ = sc.Sink.Close()
+			}
+		}
+	}
+	for i, sc := range cfg.Sinks {
+		owned[i] = pool == nil || sc.NewSink != nil
+		if sc.NewSink != nil {
+			if sc.Sink, err = sc.NewSink(token); err != nil {
+				cfg.Logger.Errorf("sink %d init error: %v", i, err)
+				abort()
+				return nil, err
+			}
+		}
+		sinks[i] = sc
 	}
 
 	// Initialize A/B Core if configured
@@ -111,18 +267,45 @@ func NewWithConfig(endpoint Endpoint, token SourceToken, cfg Config) (Client, er
 		abc, err := NewABCore(c.endpoint, c.sourceToken, c.cfg, c.h)
 		if err != nil {
 			cfg.Logger.Errorf("ab core init error: %v", err)
+			abort()
 			return nil, err
 		}
 		c.abCore = abc
-		c.abCore.Start()
+		if pool != nil {
+			if abc.storage() == nil {
+				abc.loadRemoteMeta() // fetch once, the pool refreshes it afterwards
+			}
+		} else {
+			c.abCore.Start()
+		}
 		c.cfg.Logger.Infof("sdk client initialized with A/B testing")
 	} else {
 		c.cfg.Logger.Infof("sdk client initialized")
 	}
 
 	// Start background loops only after all components are successfully initialized
-	c.wg.Add(1)
-	go c.loop()
+	for i, sc := range sinks {
+		c.sinks = append(c.sinks, newSinkWorker(sc, c.cfg, owned[i], nil))
+	}
+	if export != nil {
+		c.export = newSinkWorker(SinkConfig{
+			Sink:        export,
+			QueueSize:   cfg.MaxQueueSize,
+			RetryPolicy: exportRetryPolicy{quit: c.quit, logger: c.cfg.Logger},
+			OnError: func(_ string, events []json.RawMessage, err error) {
+				c.reportFailed(joinBatch(events), err)
+			},
+		}, c.cfg, true, c.exported)
+	}
+	if pool == nil {
+		c.wg.Add(1)
+		go c.loop()
+	}
+
+	if c.spool != nil {
+		c.wg.Add(1)
+		go c.replaySpool()
+	}
 
 	return c, nil
 }
@@ -132,27 +315,129 @@ type client struct {
 	sourceToken string
 	cfg         *Config
 	h           *httpClient
+	pool        *Pool // nil unless the client belongs to a Pool
 	quit        chan struct{}
+	closeOnce   sync.Once
+	flushReq    chan chan struct{}
+	bulkchan    chan [][]byte // batches of messages from TrackBatch
 	msgchan     chan []byte
 	wg          sync.WaitGroup
+	ctx         context.Context // parent of all requests, cancelled when CloseContext gives up
+	cancel      context.CancelFunc
 	abCore      *ABCore
-	sem         chan struct{}
+	sem         chan struct{}   // HTTPConcurrency slots, shared by all clients of a Pool
+	inflight    inflightTracker // requests dispatched by this client
+	spool       *spool
+	identity    *identityResolver // nil unless Config.Identity is set
+	redactor    *redactor         // nil unless Config.Redaction is set
+	sinks       []*sinkWorker     // from Config.Sinks
+	export      *sinkWorker       // replaces the track endpoint if Config.Export is set
+	superMu     sync.RWMutex
+	superProps  Properties // replaced, never modified, on registration
+
+	providerStuck []atomic.Int32                   // timed out calls still running, by Config.PropertyProviders index
+	onFailed      func(jsonBody []byte, err error) // set on the sender of an HTTP sink
+
+	stats         pipelineStats
+	droppedEvents atomic.Uint64
+	woken         atomic.Bool // a pool wake-up is pending
 }
 
 func (c *client) Close() error {
+	return c.CloseContext(context.Background())
+}
+
+func (c *client) CloseContext(ctx context.Context) (err error) {
 	if c == nil {
 		return nil
 	}
-	close(c.quit)
-	if c.abCore != nil {
-		c.abCore.Stop()
-	}
+	c.closeOnce.Do(func() {
+		close(c.quit)
+		if c.abCore != nil {
+			c.abCore.Stop()
+		}
+		if c.pool != nil {
+			c.pool.detach(c)
+		}
 
-	c.wg.Wait()
-	c.cfg.Logger.Debugf("sdk client closed")
+		done := make(chan struct{})
+		go func() {
+			c.wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			c.cfg.Logger.Warnf("sdk client close: %v, aborting in-flight requests", ctx.Err())
+			err = ctx.Err()
+			c.cancel()
+			<-done
+		}
+		c.cancel()
+
+		for _, w := range c.sinks {
+			if sinkErr := w.close(ctx); sinkErr != nil && err == nil {
+				err = sinkErr
+			}
+		}
+		if c.export != nil {
+			if exErr := c.export.close(ctx); exErr != nil && err == nil {
+				err = exErr
+			}
+		}
+		if c.spool != nil {
+			if spErr := c.spool.close(); spErr != nil {
+				c.cfg.Logger.Errorf("spool close error: %v", spErr)
+			}
+		}
+		c.cfg.Logger.Debugf("sdk client closed")
+	})
+	return err
+}
+
+func (c *client) Flush(ctx context.Context) error {
+	if err := c.flushTrack(ctx); err != nil {
+		return err
+	}
+	if c.export != nil {
+		if err := c.export.flush(ctx); err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+	}
+	for _, w := range c.sinks {
+		if err := w.flush(ctx); err != nil {
+			return fmt.Errorf("sink %s: %w", w.name, err)
+		}
+	}
 	return nil
 }
 
+// flushTrack sends everything queued to the track endpoint and waits for it.
+func (c *client) flushTrack(ctx context.Context) error {
+	if c.pool != nil {
+		if err := c.pool.flush(ctx, c); err != nil {
+			return err
+		}
+		return c.inflight.wait(ctx)
+	}
+
+	done := make(chan struct{})
+	select {
+	case c.flushReq <- done:
+	case <-c.quit:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.inflight.wait(ctx)
+}
+
 // ========== User Identity ==========
 
 // Identify links an anonymous ID with a login ID.
@@ -161,154 +446,158 @@ func (c *client) Identify(user User) error {
 	if user.AnonID == "" || user.LoginID == "" {
 		return ErrIdentifyRequiredBothIDs
 	}
+	if c.identity != nil {
+		if err := c.identity.link(user.AnonID, user.LoginID); err != nil {
+			c.cfg.Logger.Warnf("identity store save %s error: %v", user.AnonID, err)
+		}
+	}
 	event := NewEvent(user.AnonID, user.LoginID, PseIdentify)
 	return c.Track(event)
 }
 
+// Alias links an anonymous ID with a login ID for identity stitching only,
+// without sending an $Identify event.
+func (c *client) Alias(user User) error {
+	if user.AnonID == "" || user.LoginID == "" {
+		return ErrIdentifyRequiredBothIDs
+	}
+	if c.identity == nil {
+		return ErrIdentityNotEnabled
+	}
+	return c.identity.link(user.AnonID, user.LoginID)
+}
+
+// Unlink removes the login ID linked to an anonymous ID.
+func (c *client) Unlink(anonID string) error {
+	if c.identity == nil {
+		return ErrIdentityNotEnabled
+	}
+	return c.identity.unlink(anonID)
+}
+
 // ========== Event Tracking ==========
 
 func (c *client) TrackEvent(user User, eventName string, properties Properties) error {
+	return c.TrackEventContext(context.Background(), user, eventName, properties)
+}
+
+func (c *client) TrackEventContext(ctx context.Context, user User, eventName string, properties Properties) error {
 	if err := c.validateUser(user); err != nil {
 		return err
 	}
 	event := NewEvent(user.AnonID, user.LoginID, eventName).
-		WithProperties(NewProperties().Merge(properties))
-	return c.Track(event)
+		WithProperties(user.groupProperties(NewProperties().Merge(properties)))
+	return c.TrackContext(ctx, event)
 }
 
 func (c *client) Track(event Event) error {
-	if event.AnonID == "" && event.LoginID == "" {
-		return ErrEmptyUserIDs
-	}
+	return c.TrackContext(context.Background(), event)
+}
 
-	if err := event.Normalize(); err != nil {
-		c.cfg.Logger.Errorf("event normalize error: %v", err)
+func (c *client) TrackContext(ctx context.Context, event Event) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-
-	msg, err := json.Marshal(event)
+	msgs, err := c.encode(ctx, event)
 	if err != nil {
-		c.cfg.Logger.Errorf("event json marshal error: %v", err)
 		return err
 	}
-
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("cannot track event with closed client")
+	for _, msg := range msgs {
+		if err := c.enqueue(ctx, msg); err != nil {
+			return err
 		}
-	}()
-
-	c.msgchan <- msg
+	}
 	return nil
 }
 
-// ========== User Profile Operations ==========
-
-func (c *client) ProfileSet(user User, properties Properties) error {
-	if err := c.validateUser(user); err != nil {
-		return err
+// encode enriches, normalizes, validates and intercepts event and returns the
+// JSON form of the resulting events; none if an interceptor dropped it.
+func (c *client) encode(ctx context.Context, event Event) ([][]byte, error) {
+	if err := event.checkSubject(); err != nil {
+		return nil, err
 	}
-	userPropertyOpts := NewUserPropertyOpts()
-	for key, value := range properties {
-		userPropertyOpts.Set(key, value)
+	if event.LoginID == "" && event.Event != PseGroupSet && c.identity != nil {
+		if loginID, ok := c.identity.resolve(event.AnonID); ok {
+			event.LoginID = loginID
+		}
 	}
+	c.enrich(ctx, &event)
 
-	event := NewEvent(user.AnonID, user.LoginID, PseUserSet).
-		WithUserPropertyOpts(userPropertyOpts).
-		WithProperties(NewProperties().Set(PspUserSetType, UserSetTypeSet))
-
-	return c.Track(event)
-}
+	if err := event.NormalizeWith(c.cfg.Validation); err != nil {
+		c.cfg.Logger.Errorf("event normalize error: %v", err)
+		return nil, err
+	}
 
-func (c *client) ProfileSetOnce(user User, properties Properties) error {
-	if err := c.validateUser(user); err != nil {
-		return err
+	events, err := c.intercept(ctx, event)
+	if err != nil {
+		return nil, err
 	}
-	userPropertyOpts := NewUserPropertyOpts()
-	for key, value := range properties {
-		userPropertyOpts.SetOnce(key, value)
+	msgs := make([][]byte, 0, len(events))
+	for _, event := range events {
+		if c.redactor != nil { // last, so interceptors can't reintroduce what it removes
+			c.redactor.redact(&event)
+		}
+		msg, err := c.marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
 	}
-
-	event := NewEvent(user.AnonID, user.LoginID, PseUserSet).
-		WithUserPropertyOpts(userPropertyOpts).
-		WithProperties(NewProperties().Set(PspUserSetType, UserSetTypeSetOnce))
-
-	return c.Track(event)
+	return msgs, nil
 }
 
-func (c *client) ProfileIncrement(user User, properties Properties) error {
-	if err := c.validateUser(user); err != nil {
-		return err
+// marshal returns the JSON form of a normalized event.
+func (c *client) marshal(event Event) ([]byte, error) {
+	msg, err := json.Marshal(event)
+	if err != nil {
+		c.cfg.Logger.Errorf("event json marshal error: %v", err)
+		return nil, err
 	}
-	userPropertyOpts := NewUserPropertyOpts()
-	for key, value := range properties {
-		userPropertyOpts.Increment(key, value)
+	if len(msg)+2 > maxHTTPBodySize {
+		c.cfg.Logger.Errorf("event %s dropped: %v, size:%d", event.Event, ErrMessageTooBig, len(msg))
+		return nil, ErrMessageTooBig
 	}
+	return msg, nil
+}
 
-	event := NewEvent(user.AnonID, user.LoginID, PseUserSet).
-		WithUserPropertyOpts(userPropertyOpts).
-		WithProperties(NewProperties().Set(PspUserSetType, UserSetTypeIncrement))
+// ========== User Profile Operations ==========
 
-	return c.Track(event)
+func (c *client) ProfileSet(user User, properties Properties) error {
+	return c.profile(ProfileOperation{User: user, Type: UserSetTypeSet, Properties: properties})
 }
 
-func (c *client) ProfileAppend(user User, properties ListProperties) error {
-	if err := c.validateUser(user); err != nil {
-		return err
-	}
-	userPropertyOpts := NewUserPropertyOpts()
-	for key, value := range properties {
-		userPropertyOpts.Append(key, value)
-	}
+func (c *client) ProfileSetOnce(user User, properties Properties) error {
+	return c.profile(ProfileOperation{User: user, Type: UserSetTypeSetOnce, Properties: properties})
+}
 
-	event := NewEvent(user.AnonID, user.LoginID, PseUserSet).
-		WithUserPropertyOpts(userPropertyOpts).
-		WithProperties(NewProperties().Set(PspUserSetType, UserSetTypeAppend))
+func (c *client) ProfileIncrement(user User, properties Properties) error {
+	return c.profile(ProfileOperation{User: user, Type: UserSetTypeIncrement, Properties: properties})
+}
 
-	return c.Track(event)
+func (c *client) ProfileAppend(user User, properties ListProperties) error {
+	return c.profile(ProfileOperation{User: user, Type: UserSetTypeAppend, ListProperties: properties})
 }
 
 func (c *client) ProfileUnion(user User, properties ListProperties) error {
-	if err := c.validateUser(user); err != nil {
-		return err
-	}
-	userPropertyOpts := NewUserPropertyOpts()
-	for key, value := range properties {
-		userPropertyOpts.Union(key, value)
-	}
-
-	event := NewEvent(user.AnonID, user.LoginID, PseUserSet).
-		WithUserPropertyOpts(userPropertyOpts).
-		WithProperties(NewProperties().Set(PspUserSetType, UserSetTypeUnion))
-
-	return c.Track(event)
+	return c.profile(ProfileOperation{User: user, Type: UserSetTypeUnion, ListProperties: properties})
 }
 
 func (c *client) ProfileUnset(user User, propertyKeys ...string) error {
-	if err := c.validateUser(user); err != nil {
-		return err
-	}
-	userPropertyOpts := NewUserPropertyOpts()
-	for _, key := range propertyKeys {
-		userPropertyOpts.Unset(key)
-	}
-
-	event := NewEvent(user.AnonID, user.LoginID, PseUserSet).
-		WithUserPropertyOpts(userPropertyOpts).
-		WithProperties(NewProperties().Set(PspUserSetType, UserSetTypeUnset))
-
-	return c.Track(event)
+	return c.profile(ProfileOperation{User: user, Type: UserSetTypeUnset, Keys: propertyKeys})
 }
 
 func (c *client) ProfileDelete(user User) error {
-	if err := c.validateUser(user); err != nil {
+	return c.profile(ProfileOperation{User: user, Type: UserSetTypeDelete})
+}
+
+func (c *client) profile(op ProfileOperation) error {
+	if err := c.validateUser(op.User); err != nil {
+		return err
+	}
+	event, err := op.event()
+	if err != nil {
 		return err
 	}
-	userPropertyOpts := NewUserPropertyOpts().Delete()
-	event := NewEvent(user.AnonID, user.LoginID, PseUserSet).
-		WithUserPropertyOpts(userPropertyOpts).
-		WithProperties(NewProperties().Set(PspUserSetType, UserSetTypeDelete))
-
 	return c.Track(event)
 }
 
@@ -386,6 +675,31 @@ func (c *client) GetExperiment(user User, key string) (ABResult, error) {
 	return result, nil
 }
 
+// evaluate evaluates any A/B spec type and logs the impression.
+func (c *client) evaluate(user User, key string) (ABResult, error) {
+	if c.abCore == nil {
+		return ABResult{}, ErrABNotInited
+	}
+	if c.abCore.storage() == nil {
+		return ABResult{}, ErrABNotReady
+	}
+	if err := c.validateUser(user); err != nil {
+		return ABResult{}, err
+	}
+
+	result, err := c.abCore.Evaluate(user, key)
+	if err != nil {
+		c.cfg.Logger.Errorf("ab %s evaluation error: %v", key, err)
+		return ABResult{}, err
+	}
+
+	if !result.DisableImpress && result.Key != "" {
+		c.logABImpression(user, result)
+	}
+
+	return result, nil
+}
+
 func (c *client) GetABSpecs() ([]byte, error) {
 	if c.abCore == nil {
 		return nil, ErrABNotInited
@@ -393,12 +707,23 @@ func (c *client) GetABSpecs() ([]byte, error) {
 	return c.abCore.GetStorageSnapshot()
 }
 
+// ========== Diagnostics ==========
+
+func (c *client) DroppedEvents() uint64 {
+	return c.droppedEvents.Load()
+}
+
 // ========== Internal Helpers ==========
 
 func (c *client) validateUser(user User) error {
 	if user.AnonID == "" && user.LoginID == "" {
 		return ErrEmptyUserIDs
 	}
+	for unit, id := range user.CustomIDs {
+		if unit == "" || id == "" || strings.EqualFold(unit, "anon_id") || strings.EqualFold(unit, "login_id") {
+			return fmt.Errorf("%w: %q", ErrCustomIDInvalid, unit)
+		}
+	}
 	return nil
 }
 
@@ -439,7 +764,7 @@ func (c *client) logABImpression(user User, result ABResult) {
 		AnonID:         user.AnonID,
 		LoginID:        user.LoginID,
 		Event:          eventName,
-		Properties:     eventProps,
+		Properties:     user.groupProperties(eventProps),
 		UserProperties: userProps,
 	}
 
@@ -0,0 +1,417 @@
+// Command swimport uploads NDJSON files written by the SDK's export mode
+// (Config.Export) to a SensorsWave track endpoint.
+//
+// It uses the SDK client, so uploads get the same batching, signing and retries
+// as live tracking. Events keep their original time and trace ID. Progress is
+// stored in a checkpoint file after every chunk, so an interrupted import can be
+// started again with the same arguments.
+//
+//	swimport -endpoint https://example.sensorswave.com -source-token TOKEN /var/export
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	sensorswave "github.com/sensorswave/sdk-go"
+)
+
+type importArgs struct {
+	endpoint      string
+	sourceToken   string
+	projectSecret string
+	sign          bool
+	rate          float64
+	chunkSize     int
+	checkpoint    string
+	paths         []string
+}
+
+func main() {
+	args := parseArgs()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, args, nil); err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+	log.Println("import done")
+}
+
+func parseArgs() importArgs {
+	var args importArgs
+	flag.StringVar(&args.endpoint, "endpoint", "", "track endpoint base url")
+	flag.StringVar(&args.sourceToken, "source-token", "", "project token the events are uploaded to")
+	flag.StringVar(&args.projectSecret, "project-secret", os.Getenv("SENSORSWAVE_PROJECT_SECRET"), "project secret for -sign (default $SENSORSWAVE_PROJECT_SECRET)")
+	flag.BoolVar(&args.sign, "sign", false, "sign track requests with the project secret")
+	flag.Float64Var(&args.rate, "rate", 1000, "maximum events per second, 0 for no limit")
+	flag.IntVar(&args.chunkSize, "chunk", 500, "events uploaded between checkpoints")
+	flag.StringVar(&args.checkpoint, "checkpoint", "swimport.checkpoint.json", "file recording the import progress")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: swimport [flags] FILE_OR_DIR...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args.paths = flag.Args()
+
+	if args.endpoint == "" || args.sourceToken == "" {
+		log.Fatal("endpoint and source-token are required")
+	}
+	if len(args.paths) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if args.chunkSize <= 0 {
+		args.chunkSize = 500
+	}
+	return args
+}
+
+// run imports every file under args.paths. doer replaces net/http if set.
+func run(ctx context.Context, args importArgs, doer sensorswave.HTTPDoer) error {
+	files, err := listFiles(args.paths)
+	if err != nil {
+		return err
+	}
+	cp, err := loadCheckpoint(args.checkpoint)
+	if err != nil {
+		return err
+	}
+
+	var failure deliveryFailure
+	client, err := sensorswave.NewWithConfig(
+		sensorswave.Endpoint(args.endpoint),
+		sensorswave.SourceToken(args.sourceToken),
+		sensorswave.Config{
+			HTTPDoer:          doer,
+			Logger:            logLogger{},
+			SignTrackRequests: args.sign,
+			ProjectSecret:     args.projectSecret,
+			FlushInterval:     time.Hour, // chunks are flushed explicitly
+			OnDeliveryResult:  failure.record,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			log.Printf("close client error: %v", err)
+		}
+	}()
+
+	limit := &rateLimiter{rate: args.rate}
+	for _, file := range files {
+		if cp.Files[file].Done {
+			continue
+		}
+		if err := importFile(ctx, client, file, args.chunkSize, cp, limit, &failure); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// importFile uploads the lines of file after its checkpoint, one chunk at a time.
+func importFile(ctx context.Context, client sensorswave.Client, file string, chunkSize int, cp *checkpoint, limit *rateLimiter, failure *deliveryFailure) error {
+	r, err := openExport(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	progress := cp.Files[file]
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	for line := 0; line < progress.Lines && sc.Scan(); line++ { // skip uploaded lines
+	}
+	if progress.Lines > 0 {
+		log.Printf("%s: resuming after line %d", file, progress.Lines)
+	}
+
+	for {
+		events := make([]sensorswave.Event, 0, chunkSize)
+		lines := 0
+		for len(events) < chunkSize && sc.Scan() {
+			lines++
+			text := strings.TrimSpace(sc.Text())
+			if text == "" {
+				continue
+			}
+			var event sensorswave.Event
+			if err := json.Unmarshal([]byte(text), &event); err != nil {
+				return fmt.Errorf("line %d: %w", progress.Lines+lines, err)
+			}
+			events = append(events, event)
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+		if lines == 0 {
+			break
+		}
+
+		if err := limit.wait(ctx, len(events)); err != nil {
+			return err
+		}
+		if err := client.TrackBatch(ctx, events); err != nil {
+			var batchErr *sensorswave.BatchError
+			if !errors.As(err, &batchErr) || ctx.Err() != nil {
+				return err
+			}
+			for _, itemErr := range batchErr.Errors {
+				if itemErr != nil && !skippable(itemErr) {
+					return fmt.Errorf("upload after line %d failed, rerun to resume: %w", progress.Lines, itemErr)
+				}
+			}
+			log.Printf("%s: skipped events: %v", file, err)
+		}
+		if err := client.Flush(ctx); err != nil {
+			return err
+		}
+		if err := failure.take(); err != nil {
+			return fmt.Errorf("upload after line %d failed, rerun to resume: %w", progress.Lines, err)
+		}
+		for _, r := range failure.takeRejected() {
+			log.Printf("%s: skipped event %s rejected by the server: %s", file, r.TraceID, r.Reason)
+		}
+
+		progress.Lines += lines
+		cp.Files[file] = progress
+		if err := cp.save(); err != nil {
+			return err
+		}
+	}
+
+	progress.Done = true
+	cp.Files[file] = progress
+	log.Printf("%s: imported %d lines", file, progress.Lines)
+	return cp.save()
+}
+
+// skippable reports whether err rejects an event on every run, so the import
+// skips the event instead of stopping: invalid events and events over the size
+// limit. Other errors, such as ErrClosed or ErrTooManyRequests, are transient.
+func skippable(err error) bool {
+	var verr *sensorswave.ValidationError
+	if errors.As(err, &verr) {
+		return true
+	}
+	for _, target := range []error{
+		sensorswave.ErrEmptyUserIDs,
+		sensorswave.ErrEmptyGroup,
+		sensorswave.ErrEventNameEmpty,
+		sensorswave.ErrMessageTooBig,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// listFiles returns the completed export files under paths, in name order,
+// which is creation order for the files of one prefix.
+func listFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (strings.HasSuffix(path, ".ndjson") || strings.HasSuffix(path, ".ndjson.gz")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = abs
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// openExport opens an export file, decompressing ".gz" files.
+func openExport(file string) (io.ReadCloser, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(file, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// ========== Checkpoint ==========
+
+type fileProgress struct {
+	Lines int  `json:"lines"` // lines uploaded
+	Done  bool `json:"done"`
+}
+
+type checkpoint struct {
+	path  string
+	Files map[string]fileProgress `json:"files"` // by absolute path
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{path: path, Files: make(map[string]fileProgress)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	if cp.Files == nil {
+		cp.Files = make(map[string]fileProgress)
+	}
+	return cp, nil
+}
+
+// save replaces the checkpoint file atomically.
+func (cp *checkpoint) save() error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := cp.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.path)
+}
+
+// ========== Helpers ==========
+
+// deliveryFailure keeps the first failed batch reported since the last take,
+// and the events the server rejected since the last takeRejected.
+type deliveryFailure struct {
+	mu       sync.Mutex
+	err      error
+	rejected map[string]string // trace ID -> reason, cleared if a resend is accepted
+}
+
+func (f *deliveryFailure) record(result sensorswave.DeliveryResult) {
+	if result.HTTPCode == http.StatusRequestEntityTooLarge { // oversized batches are split and resent
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !result.Success {
+		if f.err == nil {
+			f.err = result.Err
+		}
+		return
+	}
+	for _, event := range result.Events { // retryable rejections come back in a resend
+		delete(f.rejected, event.TraceID)
+	}
+	for _, r := range result.Rejected {
+		if f.rejected == nil {
+			f.rejected = make(map[string]string)
+		}
+		f.rejected[r.TraceID] = r.Reason
+	}
+}
+
+func (f *deliveryFailure) take() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	err := f.err
+	f.err = nil
+	return err
+}
+
+// takeRejected returns the events the server refused for good, by trace ID.
+func (f *deliveryFailure) takeRejected() []sensorswave.TrackRejection {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rejected := make([]sensorswave.TrackRejection, 0, len(f.rejected))
+	for id, reason := range f.rejected {
+		rejected = append(rejected, sensorswave.TrackRejection{TraceID: id, Reason: reason})
+	}
+	sort.Slice(rejected, func(i, j int) bool { return rejected[i].TraceID < rejected[j].TraceID })
+	f.rejected = nil
+	return rejected
+}
+
+// rateLimiter spaces uploads so the average stays under rate events per second.
+type rateLimiter struct {
+	rate  float64
+	start time.Time
+	sent  int
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l.rate <= 0 {
+		return nil
+	}
+	if l.start.IsZero() {
+		l.start = time.Now()
+	}
+	due := l.start.Add(time.Duration(float64(l.sent) / l.rate * float64(time.Second)))
+	l.sent += n
+	timer := time.NewTimer(time.Until(due))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// logLogger prints SDK warnings and errors with the standard logger.
+type logLogger struct{}
+
+func (logLogger) Debugf(format string, args ...interface{}) {}
+func (logLogger) Infof(format string, args ...interface{})  {}
+func (logLogger) Warnf(format string, args ...interface{})  { log.Printf("WARN "+format, args...) }
+func (logLogger) Errorf(format string, args ...interface{}) { log.Printf("ERROR "+format, args...) }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	sensorswave "github.com/sensorswave/sdk-go"
+)
+
+type quietLogger struct{}
+
+func (quietLogger) Debugf(format string, args ...interface{}) {}
+func (quietLogger) Infof(format string, args ...interface{})  {}
+func (quietLogger) Warnf(format string, args ...interface{})  {}
+func (quietLogger) Errorf(format string, args ...interface{}) {}
+
+// exportEvents writes n events with the SDK's export mode and returns their times.
+func exportEvents(t *testing.T, dir string, n int) []int64 {
+	t.Helper()
+	c, err := sensorswave.NewWithConfig("", "token", sensorswave.Config{
+		Logger: quietLogger{},
+		Export: &sensorswave.FileSinkConfig{Dir: dir, Gzip: true, MaxBytes: 2000},
+	})
+	require.NoError(t, err)
+	times := make([]int64, n)
+	for i := range times {
+		times[i] = int64(1700000000000 + i)
+		event := sensorswave.NewEvent("", "u1", "Backfill").WithTime(times[i])
+		require.NoError(t, c.Track(event))
+	}
+	require.NoError(t, c.Close())
+	return times
+}
+
+type uploadServer struct {
+	mu     sync.Mutex
+	times  []int64
+	failOn atomic.Int32 // number of requests to reject
+}
+
+func (s *uploadServer) start() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.failOn.Load() > 0 {
+			s.failOn.Add(-1)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var events []sensorswave.Event
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			w.WriteHeader(http.StatusBadRequest) // fails the import
+			return
+		}
+		s.mu.Lock()
+		for _, e := range events {
+			s.times = append(s.times, e.Time)
+		}
+		s.mu.Unlock()
+	}))
+}
+
+func TestImportResumesFromCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	want := exportEvents(t, filepath.Join(dir, "export"), 120)
+
+	var server uploadServer
+	srv := server.start()
+	defer srv.Close()
+
+	args := importArgs{
+		endpoint:    srv.URL,
+		sourceToken: "token",
+		chunkSize:   50,
+		checkpoint:  filepath.Join(dir, "cp.json"),
+		paths:       []string{filepath.Join(dir, "export")},
+	}
+
+	server.failOn.Store(1)
+	require.Error(t, run(context.Background(), args, nil))
+	require.Empty(t, server.times)
+
+	require.NoError(t, run(context.Background(), args, nil))
+	require.Equal(t, want, server.times, "original event times are kept")
+
+	// everything is checkpointed, so a rerun uploads nothing
+	require.NoError(t, run(context.Background(), args, nil))
+	require.Len(t, server.times, len(want))
+
+	cp, err := loadCheckpoint(args.checkpoint)
+	require.NoError(t, err)
+	require.Greater(t, len(cp.Files), 1, "the export was rotated")
+	for _, p := range cp.Files {
+		require.True(t, p.Done)
+	}
+}
+
+func TestSkippable(t *testing.T) {
+	event := sensorswave.NewEvent("", "u1", "$Bogus")
+	invalid := event.NormalizeWith(sensorswave.ValidationOptions{Mode: sensorswave.ValidationStrict})
+	require.Error(t, invalid)
+
+	for _, err := range []error{invalid, sensorswave.ErrEmptyUserIDs, fmt.Errorf("event: %w", sensorswave.ErrMessageTooBig)} {
+		require.True(t, skippable(err), err)
+	}
+	for _, err := range []error{sensorswave.ErrClosed, sensorswave.ErrTooManyRequests, context.Canceled, errors.New("interceptor failed")} {
+		require.False(t, skippable(err), err)
+	}
+}
+
+func TestDeliveryFailureRecordsRejections(t *testing.T) {
+	var f deliveryFailure
+	a, b, c := sensorswave.NewEvent("", "u1", "A"), sensorswave.NewEvent("", "u1", "B"), sensorswave.NewEvent("", "u1", "C")
+	a.TraceID, b.TraceID, c.TraceID = "a", "b", "c"
+
+	f.record(sensorswave.DeliveryResult{
+		Success:  true,
+		Events:   []sensorswave.Event{a, b, c},
+		Rejected: []sensorswave.TrackRejection{{TraceID: "a", Reason: "invalid"}, {TraceID: "b", Reason: "busy", Retryable: true}},
+	})
+	f.record(sensorswave.DeliveryResult{Success: true, Events: []sensorswave.Event{b}}) // the resend is accepted
+
+	require.NoError(t, f.take())
+	require.Equal(t, []sensorswave.TrackRejection{{TraceID: "a", Reason: "invalid"}}, f.takeRejected())
+	require.Empty(t, f.takeRejected())
+}
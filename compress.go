@@ -0,0 +1,83 @@
+package sensorswave
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the encoding applied to track request bodies.
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "unknown"
+	}
+}
+
+// defaultCompressionMinBytes is the body size below which compression is skipped.
+const defaultCompressionMinBytes = 1024
+
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+var zstdEncoderPool = sync.Pool{
+	New: func() interface{} {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil { // only fails on invalid options
+			return nil
+		}
+		return enc
+	},
+}
+
+// compressBody encodes body with the given compression.
+// It returns the body unchanged and an empty encoding if the body is smaller than minBytes.
+func compressBody(c Compression, body []byte, minBytes int) (out []byte, encoding string, err error) {
+	if len(body) < minBytes {
+		return body, "", nil
+	}
+
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		buf.Grow(len(body) / 4)
+		w := gzipWriterPool.Get().(*gzip.Writer)
+		defer gzipWriterPool.Put(w)
+		w.Reset(&buf)
+		if _, err = w.Write(body); err != nil {
+			return body, "", err
+		}
+		if err = w.Close(); err != nil {
+			return body, "", err
+		}
+		return buf.Bytes(), "gzip", nil
+	case CompressionZstd:
+		enc, _ := zstdEncoderPool.Get().(*zstd.Encoder)
+		if enc == nil {
+			return body, "", nil
+		}
+		defer zstdEncoderPool.Put(enc)
+		return enc.EncodeAll(body, make([]byte, 0, len(body)/4)), "zstd", nil
+	default:
+		return body, "", nil
+	}
+}
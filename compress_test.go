@@ -0,0 +1,75 @@
+package sensorswave
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressBodyRoundTrip(t *testing.T) {
+	body := []byte(strings.Repeat(`{"event":"PageView","properties":{"$lib":"go"}},`, 100))
+
+	gz, encoding, err := compressBody(CompressionGzip, body, defaultCompressionMinBytes)
+	require.NoError(t, err)
+	require.Equal(t, "gzip", encoding)
+	require.Less(t, len(gz), len(body))
+	r, err := gzip.NewReader(bytes.NewReader(gz))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, body, plain)
+
+	zs, encoding, err := compressBody(CompressionZstd, body, defaultCompressionMinBytes)
+	require.NoError(t, err)
+	require.Equal(t, "zstd", encoding)
+	require.Less(t, len(zs), len(body))
+	dec, err := zstd.NewReader(nil)
+	require.NoError(t, err)
+	defer dec.Close()
+	plain, err = dec.DecodeAll(zs, nil)
+	require.NoError(t, err)
+	require.Equal(t, body, plain)
+}
+
+func TestCompressBodySkipsSmallBatches(t *testing.T) {
+	body := []byte(`[{"event":"a"}]`)
+	out, encoding, err := compressBody(CompressionGzip, body, defaultCompressionMinBytes)
+	require.NoError(t, err)
+	require.Empty(t, encoding)
+	require.Equal(t, body, out)
+}
+
+func TestClientSendsGzipBody(t *testing.T) {
+	type request struct {
+		encoding string
+		body     []byte
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := request{encoding: r.Header.Get("Content-Encoding")}
+		zr, err := gzip.NewReader(r.Body)
+		if err == nil {
+			req.body, _ = io.ReadAll(zr)
+		}
+		received <- req
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := Config{Logger: &noopLogger{}, Compression: CompressionGzip, CompressionMinBytes: 1}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon"}, "Compressed", nil))
+	require.NoError(t, c.Close())
+
+	req := <-received
+	require.Equal(t, "gzip", req.encoding)
+	require.Contains(t, string(req.body), `"event":"Compressed"`)
+}
@@ -16,6 +16,10 @@ type Config struct {
 	// Transport is a custom HTTP transport. If nil, the default transport is used.
 	Transport *http.Transport
 
+	// HTTPDoer sends all SDK HTTP requests (tracking and A/B metadata) instead of net/http.
+	// Use fastclient.NewHTTPClient for fasthttp, or a fake in tests. If set, Transport is ignored.
+	HTTPDoer HTTPDoer
+
 	// Logger is a custom logger. If nil, the default logger is used.
 	Logger Logger
 
@@ -31,9 +35,81 @@ type Config struct {
 	// HTTPRetry is the number of retry attempts for failed HTTP requests. Default: 2
 	HTTPRetry int
 
+	// RetryPolicy decides which failed HTTP requests are retried and when.
+	// It applies to track requests and A/B metadata loading.
+	// Default: DefaultRetryPolicy with HTTPRetry retries and a 30s budget
+	RetryPolicy RetryPolicy
+
+	// QueuePolicy decides what Track does when the event queue is full. Default: QueueBlock
+	QueuePolicy QueuePolicy
+
+	// EnqueueTimeout is the maximum wait for QueueBlockTimeout. Default: 1s
+	EnqueueTimeout time.Duration
+
+	// MaxQueueSize is the capacity of the in-memory event queue. Default: 500
+	MaxQueueSize int
+
+	// MaxBatchSize is the maximum number of events sent in one request. Default: 50
+	MaxBatchSize int
+
+	// Validation controls how events are validated before they are queued.
+	// Default: lenient mode, which drops offending properties and logs them
+	Validation ValidationOptions
+
+	// PropertyProviders add properties to every tracked event, before validation.
+	// Properties set on the event win over providers, and providers over super properties.
+	PropertyProviders []PropertyProvider
+
+	// PropertyProviderTimeout bounds each provider call; a slow provider is skipped. Default: 50ms
+	PropertyProviderTimeout time.Duration
+
+	// Interceptors run in order on every event after validation and before it is queued,
+	// including A/B impression and profile events. Each may modify, drop or fan out events.
+	Interceptors []EventInterceptor
+
+	// Redaction drops, masks, hashes or truncates personal data in properties and
+	// LoginID, after Interceptors. If nil, events are sent as given.
+	Redaction *RedactionConfig
+
+	// Compression encodes track request bodies with gzip or zstd. Default: CompressionNone
+	Compression Compression
+
+	// CompressionMinBytes is the batch size below which bodies are sent uncompressed. Default: 1024
+	CompressionMinBytes int
+
+	// SignTrackRequests signs every track request with ACS3-HMAC-SHA256 over the sent body,
+	// using ProjectSecret. Each retry is signed with a fresh timestamp and nonce.
+	SignTrackRequests bool
+
+	// ProjectSecret is the secret used to sign track requests. If empty, AB.ProjectSecret is used.
+	ProjectSecret string
+
 	// OnTrackFailHandler is called when event tracking fails.
+	//
+	// Deprecated: use OnDeliveryResult, which also reports successful batches.
 	OnTrackFailHandler OnTrackFailHandler
 
+	// OnDeliveryResult is called once for every batch request sent to the track endpoint.
+	OnDeliveryResult OnDeliveryResult
+
+	// Sinks receive a copy of every event in addition to the track endpoint, each with its
+	// own queue, batching and retries. With sinks, the endpoint may be empty to send to sinks only.
+	Sinks []SinkConfig
+
+	// Export writes every batch to local NDJSON files instead of sending it, for hosts
+	// without network access. Upload the completed files later with cmd/swimport.
+	// The endpoint may be empty in export mode. Failed writes are retried until Close,
+	// and while the export is behind, Track waits or drops as QueuePolicy says.
+	Export *FileSinkConfig
+
+	// Spool enables a durable on-disk log for pending and failed batches.
+	// If nil, events are only buffered in memory.
+	Spool *SpoolConfig
+
+	// Identity fills in the LoginID of events that only carry an AnonID,
+	// using links from Identify and Alias. If nil, events are sent as given.
+	Identity *IdentityConfig
+
 	// AB is the A/B testing configuration. If nil, A/B testing is disabled.
 	AB *ABConfig
 }
@@ -85,9 +161,54 @@ const (
 	defaultABMetaPath = "/ab/all4eval"
 )
 
+// QueuePolicy is the backpressure behavior of Track when the event queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock waits until the queue has room.
+	QueueBlock QueuePolicy = iota
+	// QueueBlockTimeout waits up to Config.EnqueueTimeout, then drops the new event.
+	QueueBlockTimeout
+	// QueueDropNewest drops the new event immediately.
+	QueueDropNewest
+	// QueueDropOldest evicts the oldest queued event to make room for the new one.
+	// The new event is always queued; evictions are counted in DroppedEvents.
+	QueueDropOldest
+)
+
+func (p QueuePolicy) String() string {
+	switch p {
+	case QueueBlock:
+		return "Block"
+	case QueueBlockTimeout:
+		return "BlockTimeout"
+	case QueueDropNewest:
+		return "DropNewest"
+	case QueueDropOldest:
+		return "DropOldest"
+	default:
+		return "Unknown"
+	}
+}
+
 // OnTrackFailHandler is called when event tracking fails.
 type OnTrackFailHandler func([]Event, error)
 
+// DeliveryResult describes the outcome of one batch request to the track endpoint.
+type DeliveryResult struct {
+	Success    bool             // the server accepted the batch (individual events may still be rejected)
+	HTTPCode   int              // final response status, 0 if no response was received
+	Err        error            // transport error, *HTTPStatusError or *RejectedError when Success is false
+	Attempts   int              // HTTP attempts including retries
+	Latency    time.Duration    // time spent on all attempts
+	BatchBytes int              // uncompressed size of the batch body
+	Events     []Event          // decoded events of the batch
+	Rejected   []TrackRejection // events the server refused, if any
+}
+
+// OnDeliveryResult is called with the outcome of every batch request.
+type OnDeliveryResult func(DeliveryResult)
+
 // Endpoint is a type alias for the API endpoint URL.
 // Using a distinct type prevents accidentally swapping endpoint and token parameters.
 type Endpoint string
@@ -181,10 +302,41 @@ func normalizeConfig(config *Config) {
 	if config.HTTPRetry == 0 {
 		config.HTTPRetry = 2
 	}
+	if config.RetryPolicy == nil {
+		config.RetryPolicy = DefaultRetryPolicy{
+			MaxRetries: config.HTTPRetry,
+			BaseDelay:  defaultRetryBaseDelay,
+			MaxDelay:   defaultRetryMaxDelay,
+			Budget:     defaultRetryBudget,
+		}
+	}
+	if config.EnqueueTimeout <= 0 {
+		config.EnqueueTimeout = time.Second
+	}
+	if config.MaxQueueSize <= 0 {
+		config.MaxQueueSize = defaultEventChanSize
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = defaultBatchSize
+	}
+	if config.PropertyProviderTimeout <= 0 {
+		config.PropertyProviderTimeout = defaultPropertyProviderTimeout
+	}
+	if config.CompressionMinBytes <= 0 {
+		config.CompressionMinBytes = defaultCompressionMinBytes
+	}
+
+	if config.Validation.Logger == nil {
+		config.Validation.Logger = config.Logger
+	}
+	normalizeValidationOptions(&config.Validation)
 
 	// Normalize AB config
 	if config.AB != nil {
 		normalizeABConfig(config.AB)
+		if config.ProjectSecret == "" {
+			config.ProjectSecret = config.AB.ProjectSecret
+		}
 	}
 }
 
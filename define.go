@@ -7,7 +7,7 @@ const (
 )
 
 const (
-	maxEventChanSize = 50 * 10         // max 500 events in channel
-	maxBatchSize     = 50              // max 50 events in a batch
-	maxHTTPBodySize  = 5 * 1024 * 1024 // max 5MB http body in a request
+	defaultEventChanSize = 50 * 10         // default 500 events in channel
+	defaultBatchSize     = 50              // default 50 events in a batch
+	maxHTTPBodySize      = 5 * 1024 * 1024 // max 5MB http body in a request
 )
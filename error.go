@@ -1,6 +1,10 @@
 package sensorswave
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
 
 var (
 	// This error is returned by methods of the `Client` interface when they are
@@ -12,6 +16,13 @@ var (
 	ErrTooManyRequests = errors.New("too many requests are already in-flight")
 	ErrInvalidResponse = errors.New("invalid response from server")
 
+	// This error is returned by Pool methods for a source token that was not added.
+	ErrProjectNotFound = errors.New("project not found in pool")
+
+	// This error is passed to the failure callback for events the server
+	// refused to ingest. Use errors.As with *RejectedError for the reason.
+	ErrEventRejected = errors.New("event rejected by server")
+
 	// This error is used to notify the client callbacks that a message send
 	// failed because the JSON representation of a message exceeded the upper
 	// limit.
@@ -19,13 +30,75 @@ var (
 
 	ErrEventNameEmpty          = errors.New("event name is empty")
 	ErrEventNameTooLong        = errors.New("event name is too long, >128")
+	ErrEventNameInvalid        = errors.New("event name must match [A-Za-z_$][A-Za-z0-9_$]*")
+	ErrEventNameReserved       = errors.New("event names starting with '$' are reserved for predefined events")
+	ErrPropertyKeyEmpty        = errors.New("property key is empty")
 	ErrPropertyKeyTooLong      = errors.New("property key is too long, >128")
+	ErrPropertyKeyReserved     = errors.New("property keys starting with '$' are reserved for predefined properties")
+	ErrPropertyValueInvalid    = errors.New("property value type is not supported")
+	ErrTooManyProperties       = errors.New("too many properties")
 	ErrEmptyUserIDs            = errors.New("login_id and anon_id are both empty")
 	ErrIdentifyRequiredBothIDs = errors.New("Identify requires both login_id and anon_id to be non-empty")
+	ErrProfileTypeInvalid      = errors.New("profile operation type is not a UserSetType* constant")
+	ErrProfileConflict         = errors.New("conflicting profile operations")
+	ErrIdentityNotEnabled      = errors.New("identity resolver is not enabled, set Config.Identity")
+	ErrEmptyGroup              = errors.New("group key and group id must both be non-empty")
+	ErrCustomIDInvalid         = errors.New("custom id unit and value must be non-empty and the unit must not be anon_id or login_id")
 
 	//
 	ErrABNotInited     = errors.New("ab core not inited")
 	ErrABNotReady      = errors.New("ab core not ready")
 	ErrABInvalidKey    = errors.New("ab key is invalid")
 	ErrABWithoutSticky = errors.New("ab need sticky handler but not set")
+
+	// These errors are returned by VerifyRequest and Verifier.Verify.
+	ErrSignatureMissing   = errors.New("authorization header is missing")
+	ErrSignatureMalformed = errors.New("authorization header is malformed")
+	ErrSignatureInvalid   = errors.New("signature does not match")
+	ErrUnknownCredential  = errors.New("unknown signature credential")
+	ErrBodyHashMismatch   = errors.New("x-content-sha256 does not match the body")
+	ErrTimestampSkew      = errors.New("x-auth-timestamp is outside the allowed skew")
+	ErrNonceReplayed      = errors.New("x-auth-nonce was already used")
+	ErrBodyTooLarge       = errors.New("request body exceeds the verifier's MaxBodyBytes")
 )
+
+// RejectedError carries the server's reason for refusing events.
+type RejectedError struct {
+	Code   int    // batch level response code, 0 for per-event rejections
+	Reason string // server message
+}
+
+func (e *RejectedError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%v: code %d: %s", ErrEventRejected, e.Code, e.Reason)
+	}
+	return fmt.Sprintf("%v: %s", ErrEventRejected, e.Reason)
+}
+
+func (e *RejectedError) Unwrap() error {
+	return ErrEventRejected
+}
+
+// PartialWriteError is returned by Sink.WriteBatch when only some events of a
+// batch could not be written. They are reported to SinkConfig.OnError without a retry.
+type PartialWriteError struct {
+	Events []json.RawMessage
+	Err    error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("%d events not written: %v", len(e.Events), e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError reports a response with a status other than 200.
+type HTTPStatusError struct {
+	Code int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected http status %d", e.Code)
+}
@@ -2,10 +2,13 @@ package fastclient
 
 import (
 	"context"
-	"sync"
+	"errors"
+	"net/http"
 	"time"
 
 	"github.com/valyala/fasthttp"
+
+	sensorswave "github.com/sensorswave/sdk-go"
 )
 
 type Config struct {
@@ -13,7 +16,8 @@ type Config struct {
 	MaxIdleConnDuration time.Duration
 	ReadTimeout         time.Duration
 	WriteTimeout        time.Duration
-	MaxTimeout          time.Duration
+	MaxTimeout          time.Duration           // deadline of each attempt including its redirects, 0 means only ctx bounds the request
+	RetryPolicy         sensorswave.RetryPolicy // retries made by DoRequest, nil means no retries
 }
 
 func DefaultConfig() *Config {
@@ -26,17 +30,24 @@ func DefaultConfig() *Config {
 	}
 }
 
+// maxRedirects is the number of redirects followed per attempt.
+const maxRedirects = 10
+
+var _ sensorswave.HTTPDoer = (*HTTPClient)(nil)
+
 // HTTPClient High-performance HTTP client
 type HTTPClient struct {
-	client   *fasthttp.Client
-	reqPool  sync.Pool // Request object pool
-	respPool sync.Pool // Response object pool
-	timeout  time.Duration
+	client      *fasthttp.Client
+	timeout     time.Duration
+	retryPolicy sensorswave.RetryPolicy
 }
 
 // NewHTTPClient creates a client instance
-// timeout=0 means no timeout limit
+// cfg.MaxTimeout=0 means no timeout limit; if cfg==nil, DefaultConfig is used
 func NewHTTPClient(cfg *Config) *HTTPClient {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
 	return &HTTPClient{
 		client: &fasthttp.Client{
 			MaxConnsPerHost:     cfg.MaxConnsPerHost,
@@ -44,31 +55,60 @@ func NewHTTPClient(cfg *Config) *HTTPClient {
 			ReadTimeout:         cfg.ReadTimeout,
 			WriteTimeout:        cfg.WriteTimeout,
 		},
-		reqPool: sync.Pool{
-			New: func() interface{} { return fasthttp.AcquireRequest() },
-		},
-		respPool: sync.Pool{
-			New: func() interface{} { return fasthttp.AcquireResponse() },
-		},
-		timeout: cfg.MaxTimeout,
+		timeout:     cfg.MaxTimeout,
+		retryPolicy: cfg.RetryPolicy,
 	}
 }
 
-// DoRequest executes a general request
+// DoRequest executes a general request, retried as Config.RetryPolicy decides;
+// ctx bounds all attempts. The SDK makes its own retries through SendRequest.
 func (c *HTTPClient) DoRequest(ctx context.Context, method, url string, headers map[string]string, body []byte) (respBody []byte, httpCode int, err error) {
-	// Acquire request/response from object pool
-	req := c.reqPool.Get().(*fasthttp.Request)
-	defer c.reqPool.Put(req)
-	resp := c.respPool.Get().(*fasthttp.Response)
-	defer c.respPool.Put(resp)
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		var header http.Header
+		respBody, httpCode, header, err = c.SendRequest(ctx, method, url, headers, body)
+		if c.retryPolicy == nil || ctx.Err() != nil || (err == nil && httpCode < http.StatusBadRequest) {
+			return
+		}
 
-	// Initialize request
-	req.Reset()
-	resp.Reset()
+		delay, retry := c.retryPolicy.NextRetry(sensorswave.RetryAttempt{
+			Attempt:  attempt,
+			HTTPCode: httpCode,
+			Header:   header,
+			Err:      err,
+			Elapsed:  time.Since(start),
+		})
+		if !retry {
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// SendRequest executes a single attempt, following up to 10 redirects, and also
+// returns the response header. It implements sensorswave.HTTPDoer, so the client
+// can be set as Config.HTTPDoer. The attempt, redirects included, ends at the
+// earlier of ctx's deadline and MaxTimeout.
+func (c *HTTPClient) SendRequest(ctx context.Context, method, url string, headers map[string]string, body []byte) (respBody []byte, httpCode int, respHeader http.Header, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, nil, err
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	release := func() {
+		fasthttp.ReleaseRequest(req)
+		fasthttp.ReleaseResponse(resp)
+	}
 
-	req.Header.SetHost("localhost")
 	req.Header.SetMethod(method)
-	req.SetRequestURI(url)
+	req.SetRequestURI(url) // Host is taken from the URL
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
@@ -76,27 +116,92 @@ func (c *HTTPClient) DoRequest(ctx context.Context, method, url string, headers
 		req.SetBody(body)
 	}
 
-	// Listen for context cancellation signal
-	done := make(chan struct{})
-	defer close(done)
-	go func() {
+	deadline, hasDeadline := c.deadline(ctx)
+	if ctx.Done() == nil { // ctx can't be canceled, no need to watch it
+		err = c.do(req, resp, deadline, hasDeadline)
+	} else {
+		done := make(chan error, 1)
+		go func() {
+			done <- c.do(req, resp, deadline, hasDeadline)
+		}()
 		select {
-		case <-ctx.Done(): // Context canceled
-			fasthttp.ReleaseRequest(req)
-			err = ctx.Err()
-		case <-done: // Normal exit
+		case err = <-done:
+		case <-ctx.Done():
+			// req and resp are still in use; release them once the attempt ends.
+			go func() {
+				<-done
+				release()
+			}()
+			return nil, 0, nil, ctx.Err()
 		}
-	}()
+	}
+	defer release()
 
-	// Execute request
-	if err := c.client.DoRedirects(req, resp, 10); err != nil {
-		return nil, 0, err
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		} else if ctxDeadline, ok := ctx.Deadline(); ok && errors.Is(err, fasthttp.ErrTimeout) && !deadline.Before(ctxDeadline) {
+			err = context.DeadlineExceeded // ctx's deadline was hit before its timer fired
+		}
+		return nil, 0, nil, err
 	}
 
-	// Copy response body to avoid memory pollution
+	// Copy response body and header, resp goes back to the pool
 	bodyCopy := make([]byte, len(resp.Body()))
 	copy(bodyCopy, resp.Body())
-	return bodyCopy, resp.StatusCode(), nil
+	respHeader = make(http.Header)
+	for k, v := range resp.Header.All() {
+		respHeader.Add(string(k), string(v))
+	}
+	return bodyCopy, resp.StatusCode(), respHeader, nil
+}
+
+// do sends req and follows redirects the way fasthttp's DoRedirects does, but
+// every hop shares the one deadline instead of getting a fresh timeout.
+func (c *HTTPClient) do(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time, hasDeadline bool) error {
+	for redirects := 0; ; redirects++ {
+		var err error
+		if hasDeadline {
+			err = c.client.DoDeadline(req, resp, deadline)
+		} else {
+			err = c.client.Do(req, resp)
+		}
+		if err != nil {
+			return err
+		}
+
+		status := resp.StatusCode()
+		if !fasthttp.StatusCodeIsRedirect(status) {
+			return nil
+		}
+		if redirects >= maxRedirects {
+			return fasthttp.ErrTooManyRedirects
+		}
+		location := resp.Header.Peek(fasthttp.HeaderLocation)
+		if len(location) == 0 {
+			return fasthttp.ErrMissingLocation
+		}
+
+		uri := fasthttp.AcquireURI()
+		req.URI().CopyTo(uri)
+		uri.UpdateBytes(location)
+		req.SetURI(uri)
+		fasthttp.ReleaseURI(uri)
+		if req.Header.IsPost() && (status == fasthttp.StatusMovedPermanently || status == fasthttp.StatusFound) {
+			req.Header.SetMethod(fasthttp.MethodGet)
+		}
+	}
+}
+
+// deadline returns the earlier of ctx's deadline and now+MaxTimeout.
+func (c *HTTPClient) deadline(ctx context.Context) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if c.timeout > 0 {
+		if timeout := time.Now().Add(c.timeout); !ok || timeout.Before(deadline) {
+			return timeout, true
+		}
+	}
+	return deadline, ok
 }
 
 // Get is a shortcut for GET requests.
@@ -0,0 +1,142 @@
+package fastclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fasthttp"
+
+	sensorswave "github.com/sensorswave/sdk-go"
+)
+
+func TestSendRequestHeaders(t *testing.T) {
+	var token, host atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token.Store(r.Header.Get("SourceToken"))
+		host.Store(r.Host)
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	c := NewHTTPClient(DefaultConfig())
+	body, code, header, err := c.SendRequest(context.Background(), fasthttp.MethodPost, server.URL, map[string]string{"SourceToken": "token"}, []byte("{}"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, code)
+	require.Equal(t, "ok", string(body))
+	require.Equal(t, "1", header.Get("Retry-After"))
+	require.Equal(t, "token", token.Load())
+	require.NotEqual(t, "localhost", host.Load())
+}
+
+func TestSendRequestFollowsRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("moved"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewHTTPClient(DefaultConfig())
+	body, code, _, err := c.SendRequest(context.Background(), fasthttp.MethodPost, server.URL+"/old", nil, []byte("{}"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "moved", string(body))
+}
+
+func TestSendRequestRedirectsShareDeadline(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(80 * time.Millisecond)
+		_, _ = w.Write([]byte("moved"))
+	}))
+	defer other.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(80 * time.Millisecond)
+		http.Redirect(w, r, other.URL+"/new", http.StatusFound)
+	}))
+	defer server.Close()
+
+	c := NewHTTPClient(&Config{MaxConnsPerHost: 1, MaxTimeout: time.Second})
+	body, code, _, err := c.SendRequest(context.Background(), fasthttp.MethodGet, server.URL+"/old", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "moved", string(body))
+
+	// Each hop fits in MaxTimeout but both together don't.
+	c = NewHTTPClient(&Config{MaxConnsPerHost: 1, MaxTimeout: 120 * time.Millisecond})
+	_, _, _, err = c.SendRequest(context.Background(), fasthttp.MethodGet, server.URL+"/old", nil, nil)
+	require.ErrorIs(t, err, fasthttp.ErrTimeout)
+}
+
+func TestSendRequestContextCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewHTTPClient(&Config{MaxConnsPerHost: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, _, _, err := c.SendRequest(ctx, fasthttp.MethodGet, server.URL, nil, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestSendRequestMaxTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewHTTPClient(&Config{MaxConnsPerHost: 1, MaxTimeout: 20 * time.Millisecond})
+	_, _, _, err := c.SendRequest(context.Background(), fasthttp.MethodGet, server.URL, nil, nil)
+	require.ErrorIs(t, err, fasthttp.ErrTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	c = NewHTTPClient(&Config{MaxConnsPerHost: 1, MaxTimeout: time.Minute})
+	_, _, _, err = c.SendRequest(ctx, fasthttp.MethodGet, server.URL, nil, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDoRequestRetry(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.Header().Set("Retry-After", time.Now().Add(-time.Second).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	policy := sensorswave.DefaultRetryPolicy{MaxRetries: 2, BaseDelay: 10 * time.Millisecond, Budget: time.Second}
+	c := NewHTTPClient(&Config{MaxConnsPerHost: 1, RetryPolicy: policy})
+	_, code, err := c.Get(context.Background(), server.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, int32(3), hits.Load())
+
+	hits.Store(0)
+	c = NewHTTPClient(&Config{MaxConnsPerHost: 1})
+	_, code, err = c.Get(context.Background(), server.URL, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, int32(1), hits.Load())
+}
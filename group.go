@@ -0,0 +1,61 @@
+package sensorswave
+
+// groupEvent builds the $GroupSet event of a profile operation on a group.
+// op.User is ignored; the event carries no user IDs, the group is keyed by
+// $group_key and $group_id. Identity resolution and super properties don't apply.
+func groupEvent(groupKey, groupID string, op ProfileOperation) (Event, error) {
+	if groupKey == "" || groupID == "" {
+		return Event{}, ErrEmptyGroup
+	}
+	if err := validatePropertyKey(groupKey, ValidationStrict); err != nil {
+		return Event{}, &ValidationError{Field: "group_key", Key: groupKey, Err: err}
+	}
+	userPropertyOpts, err := op.userPropertyOpts()
+	if err != nil {
+		return Event{}, err
+	}
+
+	event := NewEvent("", "", PseGroupSet).
+		WithUserPropertyOpts(userPropertyOpts).
+		WithProperties(NewProperties().
+			Set(PspUserSetType, op.Type).
+			Set(PspGroupKey, groupKey).
+			Set(PspGroupID, groupID))
+	return event, nil
+}
+
+func (c *client) GroupProfileSet(groupKey, groupID string, properties Properties) error {
+	return c.groupProfile(groupKey, groupID, ProfileOperation{Type: UserSetTypeSet, Properties: properties})
+}
+
+func (c *client) GroupProfileSetOnce(groupKey, groupID string, properties Properties) error {
+	return c.groupProfile(groupKey, groupID, ProfileOperation{Type: UserSetTypeSetOnce, Properties: properties})
+}
+
+func (c *client) GroupProfileIncrement(groupKey, groupID string, properties Properties) error {
+	return c.groupProfile(groupKey, groupID, ProfileOperation{Type: UserSetTypeIncrement, Properties: properties})
+}
+
+func (c *client) GroupProfileAppend(groupKey, groupID string, properties ListProperties) error {
+	return c.groupProfile(groupKey, groupID, ProfileOperation{Type: UserSetTypeAppend, ListProperties: properties})
+}
+
+func (c *client) GroupProfileUnion(groupKey, groupID string, properties ListProperties) error {
+	return c.groupProfile(groupKey, groupID, ProfileOperation{Type: UserSetTypeUnion, ListProperties: properties})
+}
+
+func (c *client) GroupProfileUnset(groupKey, groupID string, propertyKeys ...string) error {
+	return c.groupProfile(groupKey, groupID, ProfileOperation{Type: UserSetTypeUnset, Keys: propertyKeys})
+}
+
+func (c *client) GroupProfileDelete(groupKey, groupID string) error {
+	return c.groupProfile(groupKey, groupID, ProfileOperation{Type: UserSetTypeDelete})
+}
+
+func (c *client) groupProfile(groupKey, groupID string, op ProfileOperation) error {
+	event, err := groupEvent(groupKey, groupID, op)
+	if err != nil {
+		return err
+	}
+	return c.Track(event)
+}
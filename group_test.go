@@ -0,0 +1,89 @@
+package sensorswave
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupProfileSetEvent(t *testing.T) {
+	c := newImpressTestClient()
+	require.NoError(t, c.GroupProfileSet("company_id", "42", Properties{"plan": "enterprise"}))
+
+	evt := readImpressEvent(t, c)
+	require.Equal(t, PseGroupSet, evt.Event)
+	require.Empty(t, evt.AnonID)
+	require.Empty(t, evt.LoginID)
+	require.Equal(t, "company_id", evt.Properties[PspGroupKey])
+	require.Equal(t, "42", evt.Properties[PspGroupID])
+	require.Equal(t, UserSetTypeSet, evt.Properties[PspUserSetType])
+	require.Equal(t, map[string]any{"plan": "enterprise"}, evt.UserProperties["$set"])
+}
+
+func TestGroupProfileSkipsIdentityAndSuperProperties(t *testing.T) {
+	c := newImpressTestClient()
+	c.identity = newIdentityResolver(IdentityConfig{}, &noopLogger{})
+	require.NoError(t, c.identity.link("42", "user-42"))
+	require.NoError(t, c.RegisterSuperProperties(Properties{"app": "web"}))
+	require.NoError(t, c.GroupProfileSet("company_id", "42", Properties{"plan": "enterprise"}))
+
+	evt := readImpressEvent(t, c)
+	require.Empty(t, evt.AnonID)
+	require.Empty(t, evt.LoginID)
+	require.NotContains(t, evt.Properties, "app")
+}
+
+func TestGroupProfileErrors(t *testing.T) {
+	c := newImpressTestClient()
+	require.ErrorIs(t, c.GroupProfileDelete("", "42"), ErrEmptyGroup)
+	require.ErrorIs(t, c.GroupProfileIncrement("company_id", "", Properties{"seats": 1}), ErrEmptyGroup)
+	require.ErrorIs(t, c.GroupProfileUnset("$company", "42", "plan"), ErrPropertyKeyReserved)
+	require.Empty(t, c.msgchan)
+}
+
+func TestTrackEventCarriesGroups(t *testing.T) {
+	c := newImpressTestClient()
+	user := User{LoginID: "u1"}.WithGroup("company_id", "42").WithGroup("team_id", "7")
+	require.NoError(t, c.TrackEvent(user, "Invite", Properties{"team_id": "8"}))
+
+	evt := readImpressEvent(t, c)
+	require.Equal(t, "42", evt.Properties["company_id"])
+	require.Equal(t, "8", evt.Properties["team_id"], "explicit properties win")
+}
+
+func TestWithGroupDoesNotMutate(t *testing.T) {
+	base := User{LoginID: "u1"}.WithGroup("company_id", "42")
+	other := base.WithGroup("company_id", "43")
+	require.Equal(t, "42", base.Groups["company_id"])
+	require.Equal(t, "43", other.Groups["company_id"])
+}
+
+func TestGetEvalIDUsesGroup(t *testing.T) {
+	abc := &ABCore{}
+	user := User{LoginID: "u1"}.WithGroup("company_id", "42")
+	require.Equal(t, "42", abc.getEvalID(user, &ABSpec{SubjectID: "company_id"}))
+	require.Equal(t, "u1", abc.getEvalID(user, &ABSpec{SubjectID: "LOGIN_ID"}))
+}
+
+func TestGetEvalIDUsesCustomIDs(t *testing.T) {
+	abc := &ABCore{}
+	user := User{AnonID: "a1", LoginID: "u1"}.
+		WithGroup("company_id", "42").
+		WithCustomID("device_id", "d-1").
+		WithABUserProperty("session_id", 7)
+
+	tests := []struct {
+		subject string
+		want    string
+	}{
+		{"ANON_ID", "a1"},
+		{"login_id", "u1"},
+		{"device_id", "d-1"},
+		{"company_id", "42"},
+		{"session_id", "7"}, // legacy A/B property
+		{"team_id", ""},     // missing unit is not evaluable
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, abc.getEvalID(user, &ABSpec{SubjectID: tt.subject}), tt.subject)
+	}
+}
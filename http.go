@@ -18,11 +18,21 @@ func DefaultHTTPTransport() *http.Transport {
 	}
 }
 
+// HTTPDoer sends a single HTTP request. Retries and per-attempt timeouts are
+// handled by the SDK; implementations must stop when ctx is done.
+// Both the default net/http client and fastclient.HTTPClient implement it.
+type HTTPDoer interface {
+	SendRequest(ctx context.Context, method, url string, headers map[string]string, body []byte) (respBody []byte, httpCode int, respHeader http.Header, err error)
+}
+
 // httpClient is a wrapper around http.Client.
 type httpClient struct {
 	client *http.Client
+	doer   HTTPDoer // if set, requests are sent through doer instead of client
 }
 
+var _ HTTPDoer = (*httpClient)(nil)
+
 // requestOpts defines options for HTTP requests.
 type requestOpts struct {
 	URL           string
@@ -32,8 +42,13 @@ type requestOpts struct {
 	Retry         int           // default 0, without retry
 	Timeout       time.Duration // per-attempt timeout; overall time ~= (Retry+1)*Timeout + backoff, bounded by parent ctx
 	YieldInterval time.Duration // default 100ms, min:10ms
+	RetryPolicy   RetryPolicy   // if nil, a DefaultRetryPolicy built from Retry and YieldInterval
+	Signer        RequestSigner // if set, called on a copy of Headers before every attempt
 }
 
+// RequestSigner adds authentication headers for one attempt of a request.
+type RequestSigner func(headers map[string]string, body []byte)
+
 func newRequestOpts() *requestOpts {
 	return &requestOpts{Headers: make(map[string]string), YieldInterval: time.Millisecond * 100}
 }
@@ -77,6 +92,16 @@ func (o *requestOpts) WithRetry(retry int) *requestOpts {
 	return o
 }
 
+func (o *requestOpts) WithRetryPolicy(policy RetryPolicy) *requestOpts {
+	o.RetryPolicy = policy
+	return o
+}
+
+func (o *requestOpts) WithSigner(signer RequestSigner) *requestOpts {
+	o.Signer = signer
+	return o
+}
+
 func (o *requestOpts) WithTimeout(timeout time.Duration) *requestOpts {
 	o.Timeout = timeout
 	return o
@@ -101,58 +126,106 @@ func NewHTTPClient(transport *http.Transport) *httpClient {
 	}
 }
 
-// Do sends the request with per-attempt timeout and retry backoff.
+// NewHTTPClientWithDoer creates a new httpClient that sends requests through doer.
+// if doer==nil, it is the same as NewHTTPClient(transport)
+func NewHTTPClientWithDoer(transport *http.Transport, doer HTTPDoer) *httpClient {
+	h := NewHTTPClient(transport)
+	h.doer = doer
+	return h
+}
+
+// Do sends the request with per-attempt timeout; failed attempts are retried as the RetryPolicy decides.
 // If the caller needs a hard overall deadline, pass a ctx with timeout/deadline.
 func (h *httpClient) Do(ctx context.Context, opts *requestOpts) (respBody []byte, httpCode int, err error) {
-	for i := 0; i <= opts.Retry; i++ {
-		if i > 0 {
-			YieldTick(ctx, opts.YieldInterval, i) // yield for retry
-		}
+	respBody, httpCode, _, err = h.doAttempts(ctx, opts)
+	return
+}
+
+// doAttempts is Do that also returns the number of attempts made.
+func (h *httpClient) doAttempts(ctx context.Context, opts *requestOpts) (respBody []byte, httpCode int, attempts int, err error) {
+	policy := opts.RetryPolicy
+	if policy == nil {
+		policy = DefaultRetryPolicy{MaxRetries: opts.Retry, BaseDelay: opts.YieldInterval}
+	}
 
-		respBody, httpCode, err = h.doWithTimeout(ctx, opts)
-		if err != nil {
-			// opts.Timeout is per-attempt; retry continues unless parent ctx ends.
-			if ctx.Err() != nil {
-				return
+	start := time.Now()
+	for attempts = 1; ; attempts++ {
+		var header http.Header
+		respBody, httpCode, header, err = h.doWithTimeout(ctx, opts.signed())
+		if err == nil && httpCode == http.StatusOK {
+			return
+		}
+		// opts.Timeout is per-attempt; retry continues unless parent ctx ends.
+		if ctx.Err() != nil {
+			if err == nil {
+				err = ctx.Err()
 			}
-			continue
+			return
 		}
-		if httpCode == http.StatusOK {
+
+		delay, retry := policy.NextRetry(RetryAttempt{
+			Attempt:  attempts,
+			HTTPCode: httpCode,
+			Header:   header,
+			Err:      err,
+			Elapsed:  time.Since(start),
+		})
+		if !retry || !sleepContext(ctx, delay) {
 			return
 		}
-		// continue
 	}
+}
 
-	return
+// signed returns opts with Signer applied to a copy of Headers, so each attempt
+// gets a fresh timestamp and nonce.
+func (o *requestOpts) signed() *requestOpts {
+	if o.Signer == nil {
+		return o
+	}
+	attempt := *o
+	attempt.Headers = make(map[string]string, len(o.Headers)+4)
+	for k, v := range o.Headers {
+		attempt.Headers[k] = v
+	}
+	o.Signer(attempt.Headers, attempt.Body)
+	return &attempt
 }
 
-func (h *httpClient) doWithTimeout(ctx context.Context, opts *requestOpts) (respBody []byte, httpCode int, err error) {
+func (h *httpClient) doWithTimeout(ctx context.Context, opts *requestOpts) (respBody []byte, httpCode int, header http.Header, err error) {
 	if opts.Timeout > 0 {
 		ctxTimeout, cancel := context.WithTimeout(ctx, opts.Timeout)
 		defer cancel()
-		respBody, httpCode, err := h.do(ctxTimeout, opts)
+		respBody, httpCode, header, err := h.do(ctxTimeout, opts)
 		if err != nil && ctxTimeout.Err() != nil {
-			return respBody, httpCode, ctxTimeout.Err()
+			return respBody, httpCode, header, ctxTimeout.Err()
 		}
-		return respBody, httpCode, err
+		return respBody, httpCode, header, err
 	}
 	return h.do(ctx, opts)
 }
 
-func (h *httpClient) do(ctx context.Context, opts *requestOpts) (respBody []byte, httpCode int, err error) {
+func (h *httpClient) do(ctx context.Context, opts *requestOpts) (respBody []byte, httpCode int, header http.Header, err error) {
+	if h.doer != nil {
+		return h.doer.SendRequest(ctx, opts.Method, opts.URL, opts.Headers, opts.Body)
+	}
+	return h.SendRequest(ctx, opts.Method, opts.URL, opts.Headers, opts.Body)
+}
+
+// SendRequest sends a single request with net/http, without retry.
+func (h *httpClient) SendRequest(ctx context.Context, method, url string, headers map[string]string, body []byte) (respBody []byte, httpCode int, header http.Header, err error) {
 	var bodyReader io.Reader
-	if opts.Body != nil {
-		bodyReader = bytes.NewReader(opts.Body)
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
 	}
 
 	// 1. Create a request using the provided context
-	req, err := http.NewRequestWithContext(ctx, opts.Method, opts.URL, bodyReader)
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, nil, err
 	}
 
 	// 2. Set request headers
-	for key, value := range opts.Headers {
+	for key, value := range headers {
 		req.Header.Set(key, value)
 	}
 
@@ -160,17 +233,17 @@ func (h *httpClient) do(ctx context.Context, opts *requestOpts) (respBody []byte
 	resp, err := h.client.Do(req)
 	if err != nil {
 		// Error might be caused by context timeout or cancellation
-		return nil, 0, err
+		return nil, 0, nil, err
 	}
 	defer resp.Body.Close() // Ensure response body is closed
 
 	// 4. Read response
 	respBody, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, resp.StatusCode, err
+		return nil, resp.StatusCode, resp.Header, err
 	}
 
-	return respBody, resp.StatusCode, nil
+	return respBody, resp.StatusCode, resp.Header, nil
 }
 
 // Get is a shortcut for GET requests.
@@ -0,0 +1,66 @@
+package sensorswave
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDoer struct {
+	mu       sync.Mutex
+	requests []fakeRequest
+	code     int
+}
+
+type fakeRequest struct {
+	method  string
+	url     string
+	headers map[string]string
+	body    []byte
+}
+
+func (d *fakeDoer) SendRequest(ctx context.Context, method, url string, headers map[string]string, body []byte) ([]byte, int, http.Header, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requests = append(d.requests, fakeRequest{method: method, url: url, headers: headers, body: body})
+	return nil, d.code, nil, nil
+}
+
+func TestClientSendsThroughHTTPDoer(t *testing.T) {
+	doer := &fakeDoer{code: http.StatusOK}
+	cfg := Config{Logger: &noopLogger{}, FlushInterval: time.Hour, HTTPDoer: doer}
+	c, err := NewWithConfig(Endpoint("http://test.example.com"), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon"}, "Doer", nil))
+	require.NoError(t, c.Flush(context.Background()))
+
+	doer.mu.Lock()
+	defer doer.mu.Unlock()
+	require.Len(t, doer.requests, 1)
+	req := doer.requests[0]
+	require.Equal(t, "POST", req.method)
+	require.Equal(t, "http://test.example.com/in/track", req.url)
+	require.Equal(t, "test-token", req.headers["SourceToken"])
+
+	var events []Event
+	require.NoError(t, json.Unmarshal(req.body, &events))
+	require.Len(t, events, 1)
+	require.Equal(t, "Doer", events[0].Event)
+}
+
+func TestHTTPDoerRetries(t *testing.T) {
+	doer := &fakeDoer{code: http.StatusServiceUnavailable}
+	h := NewHTTPClientWithDoer(nil, doer)
+	opts := newRequestOpts().WithURL("http://test.example.com").WithRetryPolicy(DefaultRetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond})
+	_, code, err := h.Do(context.Background(), opts)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, doer.requests, 3)
+}
@@ -0,0 +1,148 @@
+package sensorswave
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// IdentityStore persists anon→login mappings for the identity resolver, e.g. in Redis or a database.
+type IdentityStore interface {
+	// LoadLoginID returns the login ID linked to anonID, or ok=false if there is none.
+	LoadLoginID(anonID string) (loginID string, ok bool, err error)
+	SaveLoginID(anonID, loginID string) error
+	DeleteLoginID(anonID string) error
+}
+
+// IdentityConfig enables filling in the LoginID of events that only carry an AnonID.
+// Mappings come from Identify and Alias, and from Store on a cache miss.
+type IdentityConfig struct {
+	// MaxEntries is the size of the in-memory cache. Default: 10000
+	MaxEntries int
+
+	// TTL is how long a cached mapping, or a cached miss, is kept. Default: 24h
+	TTL time.Duration
+
+	// Store is optional persistent storage shared across processes.
+	Store IdentityStore
+}
+
+// identity default
+const (
+	defaultIdentityMaxEntries = 10000
+	defaultIdentityTTL        = 24 * time.Hour
+)
+
+func normalizeIdentityConfig(cfg *IdentityConfig) {
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = defaultIdentityMaxEntries
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultIdentityTTL
+	}
+}
+
+// identityResolver is a bounded LRU of anon→login mappings with a TTL per entry.
+type identityResolver struct {
+	cfg    IdentityConfig
+	logger Logger
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // front is most recently used
+}
+
+type identityEntry struct {
+	anonID  string
+	loginID string // empty for a cached miss
+	expires time.Time
+}
+
+func newIdentityResolver(cfg IdentityConfig, logger Logger) *identityResolver {
+	normalizeIdentityConfig(&cfg)
+	return &identityResolver{
+		cfg:     cfg,
+		logger:  logger,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// resolve returns the login ID linked to anonID.
+func (r *identityResolver) resolve(anonID string) (string, bool) {
+	if loginID, ok := r.cached(anonID); ok {
+		return loginID, loginID != ""
+	}
+	if r.cfg.Store == nil {
+		return "", false
+	}
+
+	loginID, ok, err := r.cfg.Store.LoadLoginID(anonID)
+	if err != nil {
+		r.logger.Warnf("identity store load %s error: %v", anonID, err)
+		return "", false
+	}
+	if !ok {
+		loginID = ""
+	}
+	r.put(anonID, loginID)
+	return loginID, loginID != ""
+}
+
+// link records that anonID belongs to loginID.
+func (r *identityResolver) link(anonID, loginID string) error {
+	r.put(anonID, loginID)
+	if r.cfg.Store != nil {
+		return r.cfg.Store.SaveLoginID(anonID, loginID)
+	}
+	return nil
+}
+
+// unlink forgets the login ID of anonID.
+func (r *identityResolver) unlink(anonID string) error {
+	r.mu.Lock()
+	if elem, ok := r.entries[anonID]; ok {
+		r.lru.Remove(elem)
+		delete(r.entries, anonID)
+	}
+	r.mu.Unlock()
+	if r.cfg.Store != nil {
+		return r.cfg.Store.DeleteLoginID(anonID)
+	}
+	return nil
+}
+
+func (r *identityResolver) cached(anonID string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elem, ok := r.entries[anonID]
+	if !ok {
+		return "", false
+	}
+	entry := elem.Value.(*identityEntry)
+	if time.Now().After(entry.expires) {
+		r.lru.Remove(elem)
+		delete(r.entries, anonID)
+		return "", false
+	}
+	r.lru.MoveToFront(elem)
+	return entry.loginID, true
+}
+
+func (r *identityResolver) put(anonID, loginID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expires := time.Now().Add(r.cfg.TTL)
+	if elem, ok := r.entries[anonID]; ok {
+		entry := elem.Value.(*identityEntry)
+		entry.loginID, entry.expires = loginID, expires
+		r.lru.MoveToFront(elem)
+		return
+	}
+	r.entries[anonID] = r.lru.PushFront(&identityEntry{anonID: anonID, loginID: loginID, expires: expires})
+	for r.lru.Len() > r.cfg.MaxEntries {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.entries, oldest.Value.(*identityEntry).anonID)
+	}
+}
@@ -0,0 +1,109 @@
+package sensorswave
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memoryIdentityStore struct {
+	mu    sync.Mutex
+	links map[string]string
+	loads int
+}
+
+func (s *memoryIdentityStore) LoadLoginID(anonID string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loads++
+	loginID, ok := s.links[anonID]
+	return loginID, ok, nil
+}
+
+func (s *memoryIdentityStore) SaveLoginID(anonID, loginID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links[anonID] = loginID
+	return nil
+}
+
+func (s *memoryIdentityStore) DeleteLoginID(anonID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.links, anonID)
+	return nil
+}
+
+func TestIdentityResolverLRUAndTTL(t *testing.T) {
+	r := newIdentityResolver(IdentityConfig{MaxEntries: 2, TTL: 50 * time.Millisecond}, &noopLogger{})
+	require.NoError(t, r.link("a1", "u1"))
+	require.NoError(t, r.link("a2", "u2"))
+	_, ok := r.resolve("a1") // a1 is now most recently used
+	require.True(t, ok)
+	require.NoError(t, r.link("a3", "u3"))
+
+	_, ok = r.resolve("a2")
+	require.False(t, ok, "least recently used entry is evicted")
+	loginID, ok := r.resolve("a1")
+	require.True(t, ok)
+	require.Equal(t, "u1", loginID)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok = r.resolve("a3")
+	require.False(t, ok, "expired entry is dropped")
+}
+
+func TestIdentityResolverStore(t *testing.T) {
+	store := &memoryIdentityStore{links: map[string]string{"a1": "u1"}}
+	r := newIdentityResolver(IdentityConfig{Store: store}, &noopLogger{})
+
+	loginID, ok := r.resolve("a1")
+	require.True(t, ok)
+	require.Equal(t, "u1", loginID)
+	_, ok = r.resolve("unknown")
+	require.False(t, ok)
+	_, _ = r.resolve("a1")
+	_, _ = r.resolve("unknown")
+	require.Equal(t, 2, store.loads, "hits and misses are cached")
+
+	require.NoError(t, r.unlink("a1"))
+	_, ok = r.resolve("a1")
+	require.False(t, ok)
+	require.Empty(t, store.links)
+}
+
+func TestTrackFillsLoginIDAfterIdentify(t *testing.T) {
+	rec := &batchRecorder{}
+	server := rec.server()
+	defer server.Close()
+
+	cfg := Config{Logger: &noopLogger{}, FlushInterval: time.Hour, Identity: &IdentityConfig{}}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Identify(User{AnonID: "anon-1", LoginID: "user-1"}))
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon-1"}, "Webhook", nil))
+	require.NoError(t, c.Alias(User{AnonID: "anon-2", LoginID: "user-2"}))
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon-2"}, "Webhook", nil))
+	require.NoError(t, c.Unlink("anon-1"))
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon-1"}, "Webhook", nil))
+	require.NoError(t, c.Flush(context.Background()))
+
+	events := rec.batches[0]
+	require.Len(t, events, 4)
+	require.Equal(t, PseIdentify, events[0].Event)
+	require.Equal(t, "user-1", events[1].LoginID)
+	require.Equal(t, "user-2", events[2].LoginID)
+	require.Empty(t, events[3].LoginID)
+}
+
+func TestAliasRequiresIdentityConfig(t *testing.T) {
+	c := &client{cfg: &Config{Logger: &noopLogger{}}}
+	require.ErrorIs(t, c.Alias(User{AnonID: "a", LoginID: "u"}), ErrIdentityNotEnabled)
+	require.ErrorIs(t, c.Unlink("a"), ErrIdentityNotEnabled)
+	require.ErrorIs(t, c.Alias(User{AnonID: "a"}), ErrIdentifyRequiredBothIDs)
+}
@@ -0,0 +1,46 @@
+package sensorswave
+
+import "context"
+
+// EventInterceptor inspects an event after it was normalized and before it is queued.
+// It returns the events to send instead: the event itself, possibly modified,
+// nothing to drop it, or several events to fan it out. A non-nil error rejects
+// the event and is returned by Track.
+// The event's property maps belong to the interceptor; clone them before reusing
+// them in more than one returned event.
+type EventInterceptor func(ctx context.Context, event Event) ([]Event, error)
+
+// intercept runs event through Config.Interceptors in order.
+// Every interceptor sees each event returned by the previous one.
+func (c *client) intercept(ctx context.Context, event Event) ([]Event, error) {
+	events := []Event{event}
+	if len(c.cfg.Interceptors) == 0 {
+		return events, nil
+	}
+
+	for _, interceptor := range c.cfg.Interceptors {
+		var next []Event
+		for _, e := range events {
+			out, err := interceptor(ctx, e)
+			if err != nil {
+				c.cfg.Logger.Warnf("event %s rejected by interceptor: %v", e.Event, err)
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		if len(next) == 0 {
+			c.cfg.Logger.Debugf("event %s dropped by interceptor", event.Event)
+			return nil, nil
+		}
+		events = next
+	}
+
+	// interceptors may add or rename anything, so validate their output again
+	for i := range events {
+		if err := events[i].NormalizeWith(c.cfg.Validation); err != nil {
+			c.cfg.Logger.Errorf("intercepted event normalize error: %v", err)
+			return nil, err
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,95 @@
+package sensorswave
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newInterceptorTestClient(interceptors ...EventInterceptor) *client {
+	c := newImpressTestClient()
+	c.msgchan = make(chan []byte, 10)
+	c.cfg.Interceptors = interceptors
+	return c
+}
+
+func TestInterceptorModifyDropAndFanOut(t *testing.T) {
+	errBlocked := errors.New("blocked")
+	c := newInterceptorTestClient(
+		func(ctx context.Context, event Event) ([]Event, error) {
+			if event.LoginID == "qa-bot" {
+				return nil, nil // strip test accounts
+			}
+			if event.LoginID == "banned" {
+				return nil, errBlocked
+			}
+			if event.Event == "checkout" { // legacy name
+				event.Event = "Purchase"
+			}
+			return []Event{event}, nil
+		},
+		func(ctx context.Context, event Event) ([]Event, error) {
+			event.Properties["tenant_id"] = "t1"
+			if event.Event != "Purchase" {
+				return []Event{event}, nil
+			}
+			audit := NewEvent(event.AnonID, event.LoginID, "PurchaseAudit")
+			return []Event{event, audit}, nil
+		},
+	)
+
+	require.NoError(t, c.TrackEvent(User{LoginID: "qa-bot"}, "Login", nil))
+	require.Empty(t, c.msgchan)
+	require.ErrorIs(t, c.TrackEvent(User{LoginID: "banned"}, "Login", nil), errBlocked)
+	require.Empty(t, c.msgchan)
+
+	require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "checkout", Properties{"amount": 9.5}))
+	require.Len(t, c.msgchan, 2)
+	evt := readImpressEvent(t, c)
+	require.Equal(t, "Purchase", evt.Event)
+	require.Equal(t, "t1", evt.Properties["tenant_id"])
+	audit := readImpressEvent(t, c)
+	require.Equal(t, "PurchaseAudit", audit.Event)
+	require.Equal(t, sdkType, audit.Properties[PspLib], "fanned out events are normalized")
+}
+
+func TestInterceptorOutputIsValidated(t *testing.T) {
+	c := newInterceptorTestClient(func(ctx context.Context, event Event) ([]Event, error) {
+		event.Event = strings.Repeat("a", 129)
+		return []Event{event}, nil
+	})
+	var verr *ValidationError
+	require.ErrorAs(t, c.TrackEvent(User{LoginID: "u1"}, "Login", nil), &verr)
+	require.ErrorIs(t, verr, ErrEventNameTooLong)
+}
+
+func TestInterceptorSeesImpressions(t *testing.T) {
+	var seen []string
+	c := newInterceptorTestClient(func(ctx context.Context, event Event) ([]Event, error) {
+		seen = append(seen, event.Event)
+		return []Event{event}, nil
+	})
+	vid := "on"
+	c.logABImpression(User{LoginID: "u1"}, ABResult{ID: 1, Key: "k", Typ: int(ABTypGate), VariantID: &vid})
+	require.Equal(t, []string{PseFeatureImpress}, seen)
+}
+
+func TestTrackBatchWithInterceptor(t *testing.T) {
+	c := newInterceptorTestClient(func(ctx context.Context, event Event) ([]Event, error) {
+		if event.Event == "Skip" {
+			return nil, nil
+		}
+		return []Event{event, event}, nil
+	})
+	c.bulkchan = make(chan [][]byte, 1)
+
+	events := []Event{
+		NewEvent("", "u1", "Skip"),
+		NewEvent("", "u1", "Keep"),
+	}
+	require.NoError(t, c.TrackBatch(context.Background(), events))
+	require.Len(t, <-c.bulkchan, 2)
+}
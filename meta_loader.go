@@ -20,6 +20,7 @@ type HTTPSignatureMetaLoader struct {
 	SourceToken   string
 	ProjectSecret string
 	HTTPClient    *httpClient
+	RetryPolicy   RetryPolicy // if nil, failed loads are retried twice
 }
 
 func (l *HTTPSignatureMetaLoader) LoadMeta() (*ABDataResp, error) {
@@ -32,14 +33,15 @@ func (l *HTTPSignatureMetaLoader) LoadMeta() (*ABDataResp, error) {
 	uriPath := l.URIPath
 	requestURL := strings.TrimRight(l.Endpoint, "/") + uriPath
 
-	// Use signature authentication
+	// Use signature authentication, signed again for every attempt
 	// default empty body for GET
-	auth := SignRequest("GET", uriPath, "", headers, nil, l.SourceToken, l.ProjectSecret)
-	headers["Authorization"] = auth
+	signer := func(headers map[string]string, body []byte) {
+		SignRequest("GET", uriPath, "", headers, body, l.SourceToken, l.ProjectSecret)
+	}
 
 	// HTTP request
 	opts := newRequestOpts().WithMethod("GET").WithURL(requestURL).WithHeaders(headers).
-		WithRetry(2)
+		WithRetry(2).WithRetryPolicy(l.RetryPolicy).WithSigner(signer)
 
 	respbody, httpcode, err := l.HTTPClient.Do(context.Background(), opts)
 	if err != nil || httpcode != http.StatusOK {
@@ -0,0 +1,424 @@
+package sensorswave
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pool manages clients for many projects of one endpoint.
+// The clients share one HTTP transport and HTTPConcurrency limit, one batching
+// worker and one A/B meta refresh loop, and can be added and removed at runtime.
+type Pool struct {
+	endpoint Endpoint
+	cfg      Config // template for every project, normalized
+	h        *httpClient
+	sem      chan struct{}
+
+	mu      sync.RWMutex
+	clients map[string]*client // by source token
+	closed  bool
+
+	ready chan *client     // clients with newly queued events
+	ctrl  chan poolRequest // flush and detach requests for the worker
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// poolRequest asks the pool worker to flush, detach or queue a batch for a client.
+type poolRequest struct {
+	c      *client
+	detach bool
+	msgs   [][]byte   // from TrackBatch, queued without flushing
+	done   chan error // ErrClosed if c was closed first; nil for detach
+}
+
+// poolReadySize bounds pending wake-ups; missed ones are picked up on the next flush tick.
+const poolReadySize = 1024
+
+// NewPool creates an empty Pool. cfg is the template for every project added later;
+// its AB section, if set, enables A/B testing for all of them.
+// If cfg.Spool or cfg.Export is set, each project writes to its own subdirectory named by its token.
+// A SinkConfig.Sink in cfg is shared by all projects and closed with the Pool;
+// use SinkConfig.NewSink to give each project its own sink.
+func NewPool(endpoint Endpoint, cfg Config) (*Pool, error) {
+	normalizeConfig(&cfg)
+	if _, err := normalizeEndpoint(string(endpoint)); err != nil {
+		cfg.Logger.Errorf("endpoint normalize error: %v", err)
+		return nil, err
+	}
+
+	p := &Pool{
+		endpoint: endpoint,
+		cfg:      cfg,
+		h:        NewHTTPClientWithDoer(cfg.Transport, cfg.HTTPDoer),
+		sem:      make(chan struct{}, cfg.HTTPConcurrency),
+		clients:  make(map[string]*client),
+		ready:    make(chan *client, poolReadySize),
+		ctrl:     make(chan poolRequest),
+		quit:     make(chan struct{}),
+	}
+	for i := 0; i < cfg.HTTPConcurrency; i++ {
+		p.sem <- struct{}{}
+	}
+
+	p.wg.Add(1)
+	go p.loop()
+	if cfg.AB != nil {
+		p.wg.Add(1)
+		go p.loadMetaLoop()
+	}
+	return p, nil
+}
+
+// Add creates a client for the project identified by token.
+// projectSecret is used for A/B meta loading and SignTrackRequests; it may be empty if neither is used.
+func (p *Pool) Add(token SourceToken, projectSecret string) error {
+	p.mu.RLock()
+	_, exists := p.clients[string(token)]
+	closed := p.closed
+	p.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	if exists {
+		return fmt.Errorf("project %s already exists in pool", token)
+	}
+
+	c, err := newClient(p.endpoint, token, p.projectConfig(token, projectSecret), p)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed || p.clients[string(token)] != nil { // raced with Close or another Add
+		go c.Close()
+		if p.closed {
+			return ErrClosed
+		}
+		return fmt.Errorf("project %s already exists in pool", token)
+	}
+	p.clients[string(token)] = c
+	return nil
+}
+
+// projectConfig copies the template config for one project.
+func (p *Pool) projectConfig(token SourceToken, projectSecret string) Config {
+	cfg := p.cfg
+	cfg.ProjectSecret = projectSecret
+	if cfg.AB != nil {
+		ab := *cfg.AB
+		ab.ProjectSecret = projectSecret
+		cfg.AB = &ab
+	}
+	if cfg.Spool != nil {
+		sp := *cfg.Spool
+		sp.Dir = filepath.Join(sp.Dir, string(token))
+		cfg.Spool = &sp
+	}
+	if cfg.Export != nil {
+		ex := *cfg.Export
+		ex.Dir = filepath.Join(ex.Dir, string(token))
+		cfg.Export = &ex
+	}
+	return cfg
+}
+
+// Remove flushes and closes the client of a project and removes it from the pool.
+func (p *Pool) Remove(ctx context.Context, token SourceToken) error {
+	c, ok := p.Get(token)
+	if !ok {
+		return ErrProjectNotFound
+	}
+	return c.CloseContext(ctx)
+}
+
+// Get returns the client of a project.
+// Closing the returned client removes it from the pool.
+func (p *Pool) Get(token SourceToken) (Client, bool) {
+	c := p.get(string(token))
+	if c == nil {
+		return nil, false
+	}
+	return c, true
+}
+
+// Tokens returns the source tokens of all projects, sorted.
+func (p *Pool) Tokens() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	tokens := make([]string, 0, len(p.clients))
+	for token := range p.clients {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// Track submits an event to the project identified by token.
+func (p *Pool) Track(token SourceToken, event Event) error {
+	c := p.get(string(token))
+	if c == nil {
+		return ErrProjectNotFound
+	}
+	return c.Track(event)
+}
+
+// TrackEvent tracks a custom event for the project identified by token.
+func (p *Pool) TrackEvent(token SourceToken, user User, event string, properties Properties) error {
+	c := p.get(string(token))
+	if c == nil {
+		return ErrProjectNotFound
+	}
+	return c.TrackEvent(user, event, properties)
+}
+
+// Evaluate evaluates an A/B spec of any type for the project identified by token
+// and tracks its impression.
+func (p *Pool) Evaluate(token SourceToken, user User, key string) (ABResult, error) {
+	c := p.get(string(token))
+	if c == nil {
+		return ABResult{}, ErrProjectNotFound
+	}
+	return c.evaluate(user, key)
+}
+
+// Flush flushes every project.
+func (p *Pool) Flush(ctx context.Context) error {
+	var errs []error
+	for _, c := range p.snapshot() {
+		if err := c.Flush(ctx); err != nil && !errors.Is(err, ErrClosed) {
+			errs = append(errs, fmt.Errorf("%s: %w", c.sourceToken, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every project and stops the shared workers.
+func (p *Pool) Close() error {
+	return p.CloseContext(context.Background())
+}
+
+// CloseContext is like Close but gives up waiting when ctx is done.
+func (p *Pool) CloseContext(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	var errs []error
+	for _, c := range p.snapshot() {
+		if err := c.CloseContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.sourceToken, err))
+		}
+	}
+	close(p.quit)
+	p.wg.Wait()
+	for _, sc := range p.cfg.Sinks {
+		if sc.Sink == nil {
+			continue
+		}
+		if err := sc.Sink.Close(); err != nil {
+			p.cfg.Logger.Errorf("sink %s close error: %v", sc.Sink.Name(), err)
+			errs = append(errs, fmt.Errorf("sink %s: %w", sc.Sink.Name(), err))
+		}
+	}
+	p.cfg.Logger.Debugf("sdk pool closed")
+	return errors.Join(errs...)
+}
+
+func (p *Pool) get(token string) *client {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.clients[token]
+}
+
+func (p *Pool) snapshot() []*client {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	clients := make([]*client, 0, len(p.clients))
+	for _, c := range p.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// wake tells the worker that c has queued events.
+func (p *Pool) wake(c *client) {
+	if !c.woken.CompareAndSwap(false, true) {
+		return // a wake-up is already pending
+	}
+	select {
+	case p.ready <- c:
+	default:
+		c.woken.Store(false) // worker is busy, the next flush tick drains c
+	}
+}
+
+// flush asks the worker to send everything c has queued.
+func (p *Pool) flush(ctx context.Context, c *client) error {
+	req := poolRequest{c: c, done: make(chan error, 1)}
+	select {
+	case p.ctrl <- req:
+	case <-c.quit:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// detach removes c from the pool and has the worker drain and send its queue.
+// It is called by c.CloseContext after c.quit is closed; the drain is tracked by c.wg.
+func (p *Pool) detach(c *client) {
+	p.mu.Lock()
+	if p.clients[c.sourceToken] == c {
+		delete(p.clients, c.sourceToken)
+	}
+	p.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		select {
+		case p.ctrl <- poolRequest{c: c, detach: true}:
+		case <-p.quit: // the worker is gone, c never queued through it
+			drainClosed(c, &messageQueue{maxSize: c.cfg.MaxBatchSize})
+		}
+	}()
+}
+
+// drainClosed sends everything left in the queue of a detached client.
+func drainClosed(c *client, q *messageQueue) {
+	c.cfg.Logger.Debugf("pool detaching %s: draining messages", c.sourceToken)
+	close(c.msgchan)
+	for msg := range c.msgchan {
+		_ = c.push(q, msg)
+	}
+	_ = c.flush(q)
+	c.wg.Done()
+}
+
+// loop is the batching worker shared by all clients of the pool.
+func (p *Pool) loop() {
+	defer p.wg.Done()
+
+	tick := time.NewTicker(p.cfg.FlushInterval)
+	defer tick.Stop()
+
+	queues := make(map[*client]*messageQueue)
+	queue := func(c *client) *messageQueue {
+		q, ok := queues[c]
+		if !ok {
+			q = &messageQueue{maxSize: c.cfg.MaxBatchSize}
+			queues[c] = q
+		}
+		return q
+	}
+	drain := func(c *client, q *messageQueue) {
+		for n := len(c.msgchan); n > 0; n-- {
+			_ = c.push(q, <-c.msgchan)
+		}
+	}
+
+	for {
+		select {
+		case c := <-p.ready:
+			c.woken.Store(false)
+			select {
+			case <-c.quit: // drained by detach
+				continue
+			default:
+			}
+			drain(c, queue(c))
+		case <-tick.C:
+			for _, c := range p.snapshot() {
+				q := queue(c)
+				drain(c, q)
+				_ = c.flush(q)
+			}
+		case req := <-p.ctrl:
+			c := req.c
+			if req.detach {
+				drainClosed(c, queue(c))
+				delete(queues, c)
+				continue
+			}
+			select {
+			case <-c.quit: // raced with Close, the detach drain may be done already
+				req.done <- ErrClosed
+				continue
+			default:
+			}
+			q := queue(c)
+			drain(c, q)
+			if req.msgs != nil {
+				for _, msg := range req.msgs {
+					_ = c.push(q, msg)
+				}
+			} else {
+				_ = c.flush(q)
+			}
+			req.done <- nil
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// loadMetaLoop refreshes the A/B metadata of every project on one schedule.
+func (p *Pool) loadMetaLoop() {
+	defer p.wg.Done()
+
+	tick := time.NewTicker(p.cfg.AB.MetaLoadInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			p.loadMeta()
+		case <-p.quit:
+			p.cfg.Logger.Debugf("pool load meta loop closed")
+			return
+		}
+	}
+}
+
+// metaLoadConcurrency bounds the projects whose A/B metadata loads at once.
+const metaLoadConcurrency = 8
+
+// loadMeta refreshes the A/B metadata of every project, up to metaLoadConcurrency
+// at a time so that a slow project doesn't hold back the others.
+func (p *Pool) loadMeta() {
+	slots := make(chan struct{}, metaLoadConcurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, c := range p.snapshot() {
+		if c.abCore == nil {
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-p.quit:
+			return
+		}
+		wg.Add(1)
+		go func(abc *ABCore) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			abc.loadRemoteMeta()
+		}(c.abCore)
+	}
+}
@@ -0,0 +1,247 @@
+package sensorswave
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolRoutesByToken(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = make(map[string][]string) // token -> event names
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []Event
+		_ = json.NewDecoder(r.Body).Decode(&events)
+		token := r.Header.Get(HeaderSourceToken)
+		mu.Lock()
+		for _, e := range events {
+			received[token] = append(received[token], e.Event)
+		}
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pool, err := NewPool(Endpoint(server.URL), Config{Logger: &noopLogger{}, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	defer pool.Close()
+
+	require.NoError(t, pool.Add("token-a", ""))
+	require.NoError(t, pool.Add("token-b", ""))
+	require.Error(t, pool.Add("token-a", ""))
+	require.Equal(t, []string{"token-a", "token-b"}, pool.Tokens())
+
+	user := User{AnonID: "anon"}
+	require.NoError(t, pool.TrackEvent("token-a", user, "A1", nil))
+	require.NoError(t, pool.TrackEvent("token-b", user, "B1", nil))
+	require.NoError(t, pool.Track("token-a", NewEvent("anon", "", "A2")))
+	require.ErrorIs(t, pool.TrackEvent("token-c", user, "C1", nil), ErrProjectNotFound)
+	a, ok := pool.Get("token-a")
+	require.True(t, ok)
+	require.NoError(t, a.TrackBatch(context.Background(), []Event{NewEvent("anon", "", "A3"), NewEvent("anon", "", "A4")}))
+	require.NoError(t, pool.Flush(context.Background()))
+
+	mu.Lock()
+	require.Equal(t, []string{"A1", "A2", "A3", "A4"}, received["token-a"])
+	require.Equal(t, []string{"B1"}, received["token-b"])
+	mu.Unlock()
+
+	// Removing a project sends what it still has queued
+	require.NoError(t, pool.TrackEvent("token-b", user, "B2", nil))
+	require.NoError(t, pool.Remove(context.Background(), "token-b"))
+	require.ErrorIs(t, pool.TrackEvent("token-b", user, "B3", nil), ErrProjectNotFound)
+	require.ErrorIs(t, pool.Remove(context.Background(), "token-b"), ErrProjectNotFound)
+	require.Equal(t, []string{"token-a"}, pool.Tokens())
+
+	mu.Lock()
+	require.Equal(t, []string{"B1", "B2"}, received["token-b"])
+	mu.Unlock()
+
+	_, err = pool.Evaluate("token-a", user, "some_key")
+	require.ErrorIs(t, err, ErrABNotInited)
+}
+
+func TestPoolFlushWaitsOnlyForItsProject(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HeaderSourceToken) == "token-b" {
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	pool, err := NewPool(Endpoint(server.URL), Config{Logger: &noopLogger{}, FlushInterval: time.Hour, HTTPConcurrency: 2})
+	require.NoError(t, err)
+	require.NoError(t, pool.Add("token-a", ""))
+	require.NoError(t, pool.Add("token-b", ""))
+	a, _ := pool.Get("token-a")
+	b, _ := pool.Get("token-b")
+
+	user := User{AnonID: "anon"}
+	require.NoError(t, b.TrackEvent(user, "Stuck", nil))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, b.Flush(ctx), context.DeadlineExceeded)
+	require.Equal(t, 1, b.Stats().InFlightRequests)
+
+	// token-b's request still holds a slot, token-a's flush does not wait for it
+	require.NoError(t, a.TrackEvent(user, "Sent", nil))
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, a.Flush(ctx))
+	require.Equal(t, uint64(1), a.Stats().EventsSent)
+	require.Equal(t, 0, a.Stats().InFlightRequests)
+
+	release <- struct{}{}
+	require.NoError(t, pool.Close())
+}
+
+func TestPoolRejectsRequestsAfterDetach(t *testing.T) {
+	pool, err := NewPool(Endpoint("http://test.example.com"), Config{Logger: &noopLogger{}, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	defer pool.Close()
+	require.NoError(t, pool.Add("token-a", ""))
+	c := pool.get("token-a")
+	require.NoError(t, c.Close())
+
+	// A TrackBatch that passed its c.quit check just before Close
+	req := poolRequest{c: c, msgs: [][]byte{[]byte(`{}`)}, done: make(chan error, 1)}
+	pool.ctrl <- req
+	require.ErrorIs(t, <-req.done, ErrClosed)
+	require.Zero(t, c.Stats().QueueDepth)
+}
+
+func TestPoolClose(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		events int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []Event
+		_ = json.NewDecoder(r.Body).Decode(&batch)
+		mu.Lock()
+		events += len(batch)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pool, err := NewPool(Endpoint(server.URL), Config{Logger: &noopLogger{}, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	require.NoError(t, pool.Add("token-a", ""))
+	c, ok := pool.Get("token-a")
+	require.True(t, ok)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, c.TrackEvent(User{AnonID: "anon"}, "Closed", nil))
+	}
+	require.NoError(t, pool.Close())
+	require.ErrorIs(t, pool.Add("token-b", ""), ErrClosed)
+	require.ErrorIs(t, c.TrackEvent(User{AnonID: "anon"}, "AfterClose", nil), ErrClosed)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, 10, events)
+}
+
+func TestPoolSinks(t *testing.T) {
+	shared := &memorySink{}
+	var (
+		mu  sync.Mutex
+		own = make(map[SourceToken]*memorySink)
+	)
+	pool, err := NewPool("", Config{Logger: &noopLogger{}, FlushInterval: time.Hour, Sinks: []SinkConfig{
+		{Sink: shared},
+		{NewSink: func(token SourceToken) (Sink, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			own[token] = &memorySink{}
+			return own[token], nil
+		}},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, pool.Add("token-a", ""))
+	require.NoError(t, pool.Add("token-b", ""))
+
+	user := User{AnonID: "anon"}
+	require.NoError(t, pool.TrackEvent("token-a", user, "A1", nil))
+	require.NoError(t, pool.TrackEvent("token-b", user, "B1", nil))
+	require.NoError(t, pool.Flush(context.Background()))
+	require.Equal(t, 2, shared.count())
+	require.Equal(t, 1, own["token-a"].count())
+	require.Equal(t, 1, own["token-b"].count())
+
+	// Removing a project closes its own sinks, not the shared ones
+	require.NoError(t, pool.Remove(context.Background(), "token-a"))
+	require.True(t, own["token-a"].closed)
+	require.False(t, shared.closed)
+	require.NoError(t, pool.TrackEvent("token-b", user, "B2", nil))
+	require.NoError(t, pool.Flush(context.Background()))
+	require.Equal(t, 3, shared.count())
+
+	require.NoError(t, pool.Close())
+	require.True(t, shared.closed)
+	require.True(t, own["token-b"].closed)
+}
+
+type blockingMetaLoader struct {
+	mu      sync.Mutex
+	block   chan struct{} // loads wait on it once set
+	started chan struct{}
+}
+
+func (l *blockingMetaLoader) LoadMeta() (*ABDataResp, error) {
+	l.mu.Lock()
+	block := l.block
+	l.mu.Unlock()
+	if block != nil {
+		l.started <- struct{}{}
+		<-block
+	}
+	return &ABDataResp{UpdateTime: 1}, nil
+}
+
+func TestPoolLoadsMetaConcurrently(t *testing.T) {
+	loader := &blockingMetaLoader{started: make(chan struct{}, 3)}
+	pool, err := NewPool("http://127.0.0.1:1", Config{Logger: &noopLogger{}, AB: &ABConfig{MetaLoader: loader}})
+	require.NoError(t, err)
+	defer pool.Close()
+	for _, token := range []SourceToken{"token-a", "token-b", "token-c"} {
+		require.NoError(t, pool.Add(token, ""))
+	}
+
+	block := make(chan struct{})
+	loader.mu.Lock()
+	loader.block = block
+	loader.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		pool.loadMeta()
+		close(done)
+	}()
+
+	// All three loads start while none of them has finished
+	for i := 0; i < 3; i++ {
+		select {
+		case <-loader.started:
+		case <-time.After(time.Second):
+			t.Fatalf("only %d of 3 loads started", i)
+		}
+	}
+	close(block)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("loadMeta did not return")
+	}
+}
@@ -11,7 +11,8 @@ const (
 	PseFeatureImpress = "$FeatureImpress" // Feature impression event (Gate/Config)
 	PseExpImpress     = "$ExpImpress"     // Experiment impression event
 	// Internal events from def package
-	PseUserSet = "$UserSet" // User property event
+	PseUserSet  = "$UserSet"  // User property event
+	PseGroupSet = "$GroupSet" // Group property event
 )
 
 // User property operation types
@@ -32,6 +33,8 @@ const (
 	PspFeatureVariant = "$feature_variant"
 	PspExpKey         = "$exp_key"
 	PspExpVariant     = "$exp_variant"
+	PspGroupKey       = "$group_key" // Group type of a $GroupSet event, e.g. "company_id"
+	PspGroupID        = "$group_id"  // Group ID of a $GroupSet event
 )
 
 // Predefined properties
@@ -0,0 +1,182 @@
+package sensorswave
+
+import (
+	"context"
+	"fmt"
+)
+
+// profileUpdateOrder is the order in which ProfileUpdateBuilder.Commit emits its
+// $UserSet events. The backend takes one $user_set_type per event, so each
+// operation type becomes its own event.
+var profileUpdateOrder = []string{
+	UserSetTypeSet,
+	UserSetTypeSetOnce,
+	UserSetTypeIncrement,
+	UserSetTypeAppend,
+	UserSetTypeUnion,
+	UserSetTypeUnset,
+	UserSetTypeDelete,
+}
+
+// ProfileUpdateBuilder collects several profile operations for one user and commits them together.
+// A key may only be used by one operation type; Delete can't be combined with other operations.
+// The first error is kept and returned by Commit.
+type ProfileUpdateBuilder struct {
+	c    *client
+	user User
+	ops  map[string]*ProfileOperation // by operation type
+	keys map[string]string            // property key -> operation type
+	err  error
+}
+
+// ProfileUpdate starts a combined profile update for user.
+func (c *client) ProfileUpdate(user User) *ProfileUpdateBuilder {
+	return &ProfileUpdateBuilder{
+		c:    c,
+		user: user,
+		ops:  make(map[string]*ProfileOperation),
+		keys: make(map[string]string),
+	}
+}
+
+// Set sets a profile property ($set).
+func (b *ProfileUpdateBuilder) Set(key string, value any) *ProfileUpdateBuilder {
+	if op := b.op(UserSetTypeSet, key); op != nil {
+		op.Properties[key] = value
+	}
+	return b
+}
+
+// SetOnce sets a profile property only if it doesn't exist ($set_once).
+func (b *ProfileUpdateBuilder) SetOnce(key string, value any) *ProfileUpdateBuilder {
+	if op := b.op(UserSetTypeSetOnce, key); op != nil {
+		op.Properties[key] = value
+	}
+	return b
+}
+
+// Increment adds a number to a profile property ($increment).
+func (b *ProfileUpdateBuilder) Increment(key string, value any) *ProfileUpdateBuilder {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, float64, float32:
+	default:
+		b.fail(&ValidationError{Field: "user_properties.$increment", Key: key, Err: ErrPropertyValueInvalid})
+		return b
+	}
+	if op := b.op(UserSetTypeIncrement, key); op != nil {
+		op.Properties[key] = value
+	}
+	return b
+}
+
+// Append appends values to a list profile property ($append).
+func (b *ProfileUpdateBuilder) Append(key string, values ...any) *ProfileUpdateBuilder {
+	if op := b.op(UserSetTypeAppend, key); op != nil {
+		op.ListProperties[key] = append(op.ListProperties[key], values...)
+	}
+	return b
+}
+
+// Union adds unique values to a list profile property ($union).
+func (b *ProfileUpdateBuilder) Union(key string, values ...any) *ProfileUpdateBuilder {
+	if op := b.op(UserSetTypeUnion, key); op != nil {
+		op.ListProperties[key] = append(op.ListProperties[key], values...)
+	}
+	return b
+}
+
+// Unset removes profile properties ($unset).
+func (b *ProfileUpdateBuilder) Unset(keys ...string) *ProfileUpdateBuilder {
+	for _, key := range keys {
+		if op := b.op(UserSetTypeUnset, key); op != nil {
+			op.Keys = append(op.Keys, key)
+		}
+	}
+	return b
+}
+
+// Delete deletes the whole profile ($delete). It must be the only operation.
+func (b *ProfileUpdateBuilder) Delete() *ProfileUpdateBuilder {
+	b.op(UserSetTypeDelete, "")
+	return b
+}
+
+// Commit queues the collected operations as ordered $UserSet events, one per operation type.
+// The events are queued in one step; a failure is returned as a *BatchError.
+func (b *ProfileUpdateBuilder) Commit() error {
+	return b.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit but stops waiting for queue room when ctx is done.
+func (b *ProfileUpdateBuilder) CommitContext(ctx context.Context) error {
+	events, err := b.Events()
+	if err != nil || len(events) == 0 {
+		return err
+	}
+	return b.c.trackBatch(ctx, events, make([]error, len(events)))
+}
+
+// Events returns the $UserSet events Commit would queue, in order.
+func (b *ProfileUpdateBuilder) Events() ([]Event, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.user.AnonID == "" && b.user.LoginID == "" {
+		return nil, ErrEmptyUserIDs
+	}
+
+	events := make([]Event, 0, len(b.ops))
+	for _, typ := range profileUpdateOrder {
+		op, ok := b.ops[typ]
+		if !ok {
+			continue
+		}
+		event, err := op.event()
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 { // same time and order as the first event
+			event.Time = events[0].Time
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// op returns the operation of typ after checking key against the other operation types.
+func (b *ProfileUpdateBuilder) op(typ, key string) *ProfileOperation {
+	if b.err != nil {
+		return nil
+	}
+	_, deleting := b.ops[UserSetTypeDelete]
+	if deleting != (typ == UserSetTypeDelete) && (deleting || len(b.ops) > 0) {
+		b.fail(fmt.Errorf("%w: delete can't be combined with other operations", ErrProfileConflict))
+		return nil
+	}
+	if key != "" {
+		if other, ok := b.keys[key]; ok && other != typ {
+			b.fail(fmt.Errorf("%w: %q is used by %s and %s", ErrProfileConflict, key, other, typ))
+			return nil
+		}
+		b.keys[key] = typ
+	}
+
+	op, ok := b.ops[typ]
+	if !ok {
+		op = &ProfileOperation{User: b.user, Type: typ}
+		switch typ {
+		case UserSetTypeSet, UserSetTypeSetOnce, UserSetTypeIncrement:
+			op.Properties = NewProperties()
+		case UserSetTypeAppend, UserSetTypeUnion:
+			op.ListProperties = NewListProperties()
+		}
+		b.ops[typ] = op
+	}
+	return op
+}
+
+func (b *ProfileUpdateBuilder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,78 @@
+package sensorswave
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileUpdateEvents(t *testing.T) {
+	c := &client{cfg: &Config{Logger: &noopLogger{}}}
+	events, err := c.ProfileUpdate(User{LoginID: "user-1"}).
+		Unset("legacy").
+		Set("plan", "pro").
+		Increment("logins", 1).
+		Set("name", "Alice").
+		Union("tags", "a", "b").
+		Union("tags", "c").
+		Events()
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+
+	types := make([]any, 0, len(events))
+	for _, e := range events {
+		require.Equal(t, PseUserSet, e.Event)
+		require.Equal(t, events[0].Time, e.Time)
+		types = append(types, e.Properties[PspUserSetType])
+	}
+	require.Equal(t, []any{UserSetTypeSet, UserSetTypeIncrement, UserSetTypeUnion, UserSetTypeUnset}, types)
+	require.Equal(t, map[string]any{"plan": "pro", "name": "Alice"}, events[0].UserProperties["$set"])
+	require.Equal(t, map[string]any{"tags": []any{"a", "b", "c"}}, events[2].UserProperties["$union"])
+}
+
+func TestProfileUpdateConflicts(t *testing.T) {
+	c := &client{cfg: &Config{Logger: &noopLogger{}}}
+	user := User{LoginID: "user-1"}
+
+	_, err := c.ProfileUpdate(user).Set("plan", "pro").Unset("plan").Events()
+	require.ErrorIs(t, err, ErrProfileConflict)
+
+	_, err = c.ProfileUpdate(user).Set("plan", "pro").Delete().Events()
+	require.ErrorIs(t, err, ErrProfileConflict)
+
+	_, err = c.ProfileUpdate(user).Delete().SetOnce("first_seen", "2025-01-01").Events()
+	require.ErrorIs(t, err, ErrProfileConflict)
+
+	_, err = c.ProfileUpdate(user).Increment("logins", "one").Events()
+	require.ErrorIs(t, err, ErrPropertyValueInvalid)
+
+	_, err = c.ProfileUpdate(User{}).Set("plan", "pro").Events()
+	require.ErrorIs(t, err, ErrEmptyUserIDs)
+
+	events, err := c.ProfileUpdate(user).Set("plan", "pro").Set("plan", "free").Events()
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"plan": "free"}, events[0].UserProperties["$set"])
+}
+
+func TestProfileUpdateCommit(t *testing.T) {
+	rec := &batchRecorder{}
+	server := rec.server()
+	defer server.Close()
+
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), Config{Logger: &noopLogger{}, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	defer c.Close()
+
+	err = c.ProfileUpdate(User{LoginID: "user-1"}).
+		SetOnce("first_seen", "2025-01-01").
+		Set("plan", "pro").
+		Commit()
+	require.NoError(t, err)
+	require.NoError(t, c.Flush(context.Background()))
+
+	require.Equal(t, []int{2}, rec.sizes())
+	require.Equal(t, UserSetTypeSet, rec.batches[0][0].Properties[PspUserSetType])
+	require.Equal(t, UserSetTypeSetOnce, rec.batches[0][1].Properties[PspUserSetType])
+}
@@ -0,0 +1,318 @@
+package sensorswave
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactAction is what a RedactionRule does with a matching property.
+type RedactAction int
+
+const (
+	// RedactDrop removes the property.
+	RedactDrop RedactAction = iota
+	// RedactMask replaces all but the last 4 characters with '*'.
+	RedactMask
+	// RedactHash replaces the value with its hex HMAC-SHA256 keyed by RedactionConfig.HashKey,
+	// so equal values stay joinable without being readable.
+	RedactHash
+	// RedactTruncate cuts IP addresses to their /24 (IPv4) or /48 (IPv6) network,
+	// and other strings to RedactionRule.KeepChars characters.
+	RedactTruncate
+)
+
+func (a RedactAction) String() string {
+	switch a {
+	case RedactDrop:
+		return "Drop"
+	case RedactMask:
+		return "Mask"
+	case RedactHash:
+		return "Hash"
+	case RedactTruncate:
+		return "Truncate"
+	default:
+		return "Unknown"
+	}
+}
+
+// Value detectors for RedactionRule.Detector. They are heuristics that match
+// anywhere in a string value; numeric property values are never matched.
+// DetectPhone only matches numbers with a leading '+', an area code in
+// parentheses or three separated groups, so dates, timestamps and IDs are
+// left alone; use a key rule such as "*phone*" for unformatted numbers.
+var (
+	DetectEmail = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	DetectPhone = regexp.MustCompile(`\+[0-9]{1,3}[ \-]?[0-9]{2,4}(?:[ \-]?[0-9]{2,4}){1,4}\b|\([0-9]{2,4}\)[ \-]?[0-9]{3,4}[ \-]?[0-9]{4}\b|\b[0-9]{2,4}[ \-][0-9]{3,4}[ \-][0-9]{4}\b`)
+	DetectIP    = regexp.MustCompile(`\b(?:[0-9]{1,3}\.){3}[0-9]{1,3}\b|\b(?:[0-9A-Fa-f]{1,4}:){7}[0-9A-Fa-f]{1,4}\b|\b[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4})*::(?:[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4})*\b)?|::[0-9A-Fa-f]{1,4}(?::[0-9A-Fa-f]{1,4})*\b`)
+)
+
+// RedactionRule selects properties by key or by value and redacts them.
+type RedactionRule struct {
+	// Keys are case-insensitive property key patterns in path.Match syntax, e.g. "email" or "*phone*".
+	Keys []string
+
+	// Detector matches string values, including strings inside lists and maps, whatever their key.
+	Detector *regexp.Regexp
+
+	// Action is applied to the whole matching value.
+	Action RedactAction
+
+	// KeepChars is the length RedactTruncate keeps of strings that are not IP addresses. Default: 0
+	KeepChars int
+}
+
+// RedactedField describes one redacted value.
+type RedactedField struct {
+	Field  string // "properties", "user_properties.<operator>" or "login_id"
+	Key    string // top-level property key
+	Rule   int    // index into RedactionConfig.Rules, -1 for HashLoginID
+	Action RedactAction
+}
+
+// RedactionReport lists what was redacted in one event. It never contains the original values.
+type RedactionReport struct {
+	Event  string
+	Fields []RedactedField
+}
+
+// RedactionConfig removes or obscures personal data before events leave the process.
+// Rules apply to event properties and to every user property operator map;
+// the first matching rule wins.
+type RedactionConfig struct {
+	Rules []RedactionRule
+
+	// HashKey is the local HMAC secret for RedactHash and HashLoginID.
+	HashKey []byte
+
+	// HashLoginID replaces the LoginID of every event with its RedactHash form.
+	HashLoginID bool
+
+	// OnRedact is called for every event in which something was redacted.
+	OnRedact func(RedactionReport)
+}
+
+// redactor applies a RedactionConfig.
+type redactor struct {
+	cfg RedactionConfig
+}
+
+func newRedactor(cfg RedactionConfig) (*redactor, error) {
+	needsKey := cfg.HashLoginID
+	for i, rule := range cfg.Rules {
+		if len(rule.Keys) == 0 && rule.Detector == nil {
+			return nil, fmt.Errorf("redaction rule %d has neither Keys nor Detector", i)
+		}
+		for _, pattern := range rule.Keys {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("redaction rule %d key %q: %w", i, pattern, err)
+			}
+		}
+		needsKey = needsKey || rule.Action == RedactHash
+	}
+	if needsKey && len(cfg.HashKey) == 0 {
+		return nil, fmt.Errorf("redaction HashKey is required for RedactHash and HashLoginID")
+	}
+	return &redactor{cfg: cfg}, nil
+}
+
+// redact redacts event and reports what it changed. The property maps may be
+// shared with the caller, so changed maps are replaced by redacted copies.
+func (r *redactor) redact(event *Event) {
+	report := RedactionReport{Event: event.Event}
+
+	if r.cfg.HashLoginID && event.LoginID != "" {
+		event.LoginID = r.hash(event.LoginID)
+		report.Fields = append(report.Fields, RedactedField{Field: "login_id", Rule: -1, Action: RedactHash})
+	}
+	if props, changed := r.redactMap("properties", event.Properties, &report); changed {
+		event.Properties = props
+	}
+	var userProps UserPropertyOpts
+	for op, val := range event.UserProperties {
+		if op == "$unset" { // only keys, which must stay intact
+			continue
+		}
+		props, ok := val.(map[string]any)
+		if !ok {
+			continue
+		}
+		if redacted, changed := r.redactMap("user_properties."+op, props, &report); changed {
+			if userProps == nil {
+				userProps = make(UserPropertyOpts, len(event.UserProperties))
+			}
+			userProps[op] = redacted
+		}
+	}
+	if userProps != nil {
+		for op, val := range event.UserProperties {
+			if _, ok := userProps[op]; !ok {
+				userProps[op] = val
+			}
+		}
+		event.UserProperties = userProps
+	}
+
+	if len(report.Fields) > 0 && r.cfg.OnRedact != nil {
+		r.cfg.OnRedact(report)
+	}
+}
+
+// redactMap returns a redacted copy of props if a rule matched.
+func (r *redactor) redactMap(field string, props map[string]any, report *RedactionReport) (map[string]any, bool) {
+	var out map[string]any
+	for key, value := range props {
+		if key == PspLib || key == PspLibVersion {
+			continue
+		}
+		value, rule, drop := r.redactValue(key, value)
+		if rule < 0 {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]any, len(props))
+			for k, v := range props {
+				out[k] = v
+			}
+		}
+		if drop {
+			delete(out, key)
+		} else {
+			out[key] = value
+		}
+		report.Fields = append(report.Fields, RedactedField{Field: field, Key: key, Rule: rule, Action: r.cfg.Rules[rule].Action})
+	}
+	return out, out != nil
+}
+
+// redactValue returns the redacted value of key and the index of the rule that
+// matched first, or -1. Lists and maps are searched by the rules' detectors and
+// returned as copies.
+func (r *redactor) redactValue(key string, value any) (any, int, bool) {
+	for i, rule := range r.cfg.Rules {
+		if rule.matchKey(key) {
+			return r.apply(rule, value), i, rule.Action == RedactDrop
+		}
+	}
+
+	switch val := value.(type) {
+	case string:
+		for i, rule := range r.cfg.Rules {
+			if rule.Detector != nil && rule.Detector.MatchString(val) {
+				return r.apply(rule, val), i, rule.Action == RedactDrop
+			}
+		}
+	case []any:
+		first := -1
+		var out []any
+		for j, elem := range val {
+			v, rule, drop := r.redactValue("", elem)
+			if rule < 0 {
+				if out != nil {
+					out = append(out, elem)
+				}
+				continue
+			}
+			if out == nil {
+				out = append(make([]any, 0, len(val)), val[:j]...)
+			}
+			if first < 0 {
+				first = rule
+			}
+			if !drop {
+				out = append(out, v)
+			}
+		}
+		if first >= 0 {
+			return out, first, false
+		}
+	case map[string]any:
+		first := -1
+		var out map[string]any
+		for k, elem := range val {
+			v, rule, drop := r.redactValue(k, elem)
+			if rule < 0 {
+				continue
+			}
+			if out == nil {
+				out = make(map[string]any, len(val))
+				for k2, v2 := range val {
+					out[k2] = v2
+				}
+			}
+			if first < 0 {
+				first = rule
+			}
+			if drop {
+				delete(out, k)
+			} else {
+				out[k] = v
+			}
+		}
+		if first >= 0 {
+			return out, first, false
+		}
+	}
+	return value, -1, false
+}
+
+func (rule RedactionRule) matchKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	key = strings.ToLower(key)
+	for _, pattern := range rule.Keys {
+		if ok, _ := path.Match(strings.ToLower(pattern), key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apply redacts a whole value with rule.Action. Non-string values are formatted first.
+func (r *redactor) apply(rule RedactionRule, value any) any {
+	if rule.Action == RedactDrop || value == nil {
+		return nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		s = fmt.Sprintf("%v", value)
+	}
+
+	switch rule.Action {
+	case RedactMask:
+		n := utf8.RuneCountInString(s)
+		if n <= 4 {
+			return strings.Repeat("*", n)
+		}
+		runes := []rune(s)
+		return strings.Repeat("*", n-4) + string(runes[n-4:])
+	case RedactHash:
+		return r.hash(s)
+	case RedactTruncate:
+		if ip := net.ParseIP(s); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				return ip4.Mask(net.CIDRMask(24, 32)).String()
+			}
+			return ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+		if runes := []rune(s); len(runes) > rule.KeepChars {
+			return string(runes[:rule.KeepChars])
+		}
+		return s
+	}
+	return nil
+}
+
+func (r *redactor) hash(s string) string {
+	mac := hmac.New(sha256.New, r.cfg.HashKey)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,137 @@
+package sensorswave
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectors(t *testing.T) {
+	require.True(t, DetectEmail.MatchString("contact: bob@example.com"))
+	require.True(t, DetectPhone.MatchString("+1 415-555-0123"))
+	require.True(t, DetectPhone.MatchString("+8613812345678"))
+	require.True(t, DetectPhone.MatchString("call (415) 555-0123"))
+	require.True(t, DetectPhone.MatchString("138 1234 5678"))
+	for _, s := range []string{"2025-06-09 10:11:20", "20250609", "12345678", "1234-5678", "1700000000000", "13812345678"} {
+		require.False(t, DetectPhone.MatchString(s), s)
+	}
+	require.True(t, DetectIP.MatchString("180.79.35.65"))
+	require.True(t, DetectIP.MatchString("2001:db8::1"))
+	require.False(t, DetectIP.MatchString("10:11:20"))
+}
+
+func TestRedactorActions(t *testing.T) {
+	key := []byte("local-secret")
+	var reports []RedactionReport
+	r, err := newRedactor(RedactionConfig{
+		Rules: []RedactionRule{
+			{Keys: []string{"password"}, Action: RedactDrop},
+			{Keys: []string{"$ip"}, Action: RedactTruncate},
+			{Keys: []string{"*Phone*"}, Action: RedactMask},
+			{Detector: DetectEmail, Action: RedactHash},
+		},
+		HashKey:     key,
+		HashLoginID: true,
+		OnRedact:    func(r RedactionReport) { reports = append(reports, r) },
+	})
+	require.NoError(t, err)
+
+	hash := func(s string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	event := NewEvent("a1", "bob@example.com", "Signup").
+		WithProperties(Properties{
+			"password":     "hunter2",
+			PspIP:          "180.79.35.65",
+			"mobile_phone": "13812345678",
+			"note":         "reach me at bob@example.com",
+			"emails":       []any{"x@example.com", "plain"},
+			"plan":         "pro",
+		}).
+		WithUserPropertyOpts(NewUserPropertyOpts().
+			Set("contact_email", "bob@example.com").
+			Unset("password"))
+	require.NoError(t, event.Normalize())
+	r.redact(&event)
+
+	require.Equal(t, hash("bob@example.com"), event.LoginID)
+	require.NotContains(t, event.Properties, "password")
+	require.Equal(t, "180.79.35.0", event.Properties[PspIP])
+	require.Equal(t, "*******5678", event.Properties["mobile_phone"])
+	require.Equal(t, hash("reach me at bob@example.com"), event.Properties["note"])
+	require.Equal(t, []any{hash("x@example.com"), "plain"}, event.Properties["emails"])
+	require.Equal(t, "pro", event.Properties["plan"])
+	require.Equal(t, sdkType, event.Properties[PspLib])
+	require.Equal(t, hash("bob@example.com"), event.UserProperties["$set"].(map[string]any)["contact_email"])
+	require.Contains(t, event.UserProperties["$unset"], "password", "unset keys are kept")
+
+	require.Len(t, reports, 1)
+	require.Equal(t, "Signup", reports[0].Event)
+	require.Len(t, reports[0].Fields, 7)
+}
+
+func TestRedactTruncateIPv6AndStrings(t *testing.T) {
+	r, err := newRedactor(RedactionConfig{Rules: []RedactionRule{
+		{Keys: []string{"ip"}, Action: RedactTruncate},
+		{Keys: []string{"zip"}, Action: RedactTruncate, KeepChars: 3},
+	}})
+	require.NoError(t, err)
+	props := map[string]any{"ip": "2001:db8:abcd:12::1", "zip": "94107"}
+	got, changed := r.redactMap("properties", props, &RedactionReport{})
+	require.True(t, changed)
+	require.Equal(t, "2001:db8:abcd::", got["ip"])
+	require.Equal(t, "941", got["zip"])
+	require.Equal(t, "94107", props["zip"], "the input is not modified")
+}
+
+func TestNewRedactorErrors(t *testing.T) {
+	_, err := newRedactor(RedactionConfig{Rules: []RedactionRule{{Keys: []string{"email"}, Action: RedactHash}}})
+	require.Error(t, err, "hash needs a key")
+	_, err = newRedactor(RedactionConfig{Rules: []RedactionRule{{Action: RedactDrop}}})
+	require.Error(t, err, "rule needs keys or a detector")
+	_, err = newRedactor(RedactionConfig{Rules: []RedactionRule{{Keys: []string{"[email"}}}})
+	require.Error(t, err, "bad pattern")
+}
+
+func TestTrackAppliesRedaction(t *testing.T) {
+	c := newImpressTestClient()
+	r, err := newRedactor(RedactionConfig{Rules: []RedactionRule{{Detector: DetectEmail, Action: RedactDrop}}})
+	require.NoError(t, err)
+	c.redactor = r
+
+	require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "Login", Properties{"email": "bob@example.com", "ok": 1}))
+	evt := readImpressEvent(t, c)
+	require.NotContains(t, evt.Properties, "email")
+	require.EqualValues(t, 1, evt.Properties["ok"])
+}
+
+func TestRedactionLeavesCallerMapsAlone(t *testing.T) {
+	c := newImpressTestClient()
+	key := []byte("local-secret")
+	r, err := newRedactor(RedactionConfig{Rules: []RedactionRule{{Keys: []string{"email"}, Action: RedactHash}}, HashKey: key})
+	require.NoError(t, err)
+	c.redactor = r
+
+	props := Properties{"email": "bob@example.com"}
+	user := User{LoginID: "u1"}
+	require.NoError(t, c.TrackEvent(user, "Login", props))
+	first := readImpressEvent(t, c)
+	require.NoError(t, c.TrackEvent(user, "Login", props))
+	second := readImpressEvent(t, c)
+
+	require.Equal(t, "bob@example.com", props["email"])
+	require.Equal(t, r.hash("bob@example.com"), first.Properties["email"])
+	require.Equal(t, first.Properties["email"], second.Properties["email"], "not hashed twice")
+
+	set := map[string]any{"email": "bob@example.com"}
+	require.NoError(t, c.ProfileSet(user, set))
+	profile := readImpressEvent(t, c)
+	require.Equal(t, "bob@example.com", set["email"])
+	require.Equal(t, r.hash("bob@example.com"), profile.UserProperties["$set"].(map[string]any)["email"])
+}
@@ -0,0 +1,120 @@
+package sensorswave
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryAttempt describes a finished HTTP attempt handed to a RetryPolicy.
+type RetryAttempt struct {
+	Attempt  int           // 1-based number of the attempt that just finished
+	HTTPCode int           // response status, 0 if no response was received
+	Header   http.Header   // response header, nil if no response was received
+	Err      error         // transport error, nil if a response was received
+	Elapsed  time.Duration // time since the first attempt started
+}
+
+// RetryPolicy decides whether a failed HTTP request is retried and how long to wait before it.
+type RetryPolicy interface {
+	// NextRetry returns the wait before the next attempt, or false to give up.
+	NextRetry(a RetryAttempt) (time.Duration, bool)
+}
+
+// DefaultRetryPolicy retries network errors, 429 and 5xx responses; other
+// statuses are never retried. Waits use exponential backoff with full jitter,
+// or the server's Retry-After when present.
+type DefaultRetryPolicy struct {
+	MaxRetries int           // retries after the first attempt
+	BaseDelay  time.Duration // backoff base, default 100ms
+	MaxDelay   time.Duration // backoff cap, default 5s
+	Budget     time.Duration // total time for all attempts and waits, 0 means unlimited
+}
+
+// retry policy default
+const (
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay  = 5 * time.Second
+	defaultRetryBudget    = 30 * time.Second
+)
+
+var _ RetryPolicy = DefaultRetryPolicy{}
+
+func (p DefaultRetryPolicy) NextRetry(a RetryAttempt) (time.Duration, bool) {
+	if a.Attempt > p.MaxRetries || !isRetryable(a.HTTPCode, a.Err) {
+		return 0, false
+	}
+
+	delay, ok := retryAfter(a.Header, time.Now())
+	if !ok {
+		delay = p.backoff(a.Attempt)
+	}
+	if p.Budget > 0 && a.Elapsed+delay > p.Budget {
+		return 0, false
+	}
+	return delay, true
+}
+
+// backoff returns a random wait in [0, min(MaxDelay, BaseDelay*2^(attempt-1))).
+func (p DefaultRetryPolicy) backoff(attempt int) time.Duration {
+	base := p.BaseDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+
+	ceil := maxDelay
+	if shift := attempt - 1; shift < 30 && base<<shift < maxDelay {
+		ceil = base << shift
+	}
+	return time.Duration(rand.Int63n(int64(ceil)) + 1)
+}
+
+// isRetryable reports whether a request may succeed when sent again.
+func isRetryable(httpCode int, err error) bool {
+	if err != nil {
+		return true
+	}
+	return httpCode == http.StatusTooManyRequests || httpCode >= http.StatusInternalServerError
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d and reports false if ctx ended first.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,90 @@
+package sensorswave
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultRetryPolicyStatusClasses(t *testing.T) {
+	p := DefaultRetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}
+
+	cases := []struct {
+		code  int
+		err   error
+		retry bool
+	}{
+		{code: 0, err: errors.New("connection reset"), retry: true},
+		{code: http.StatusTooManyRequests, retry: true},
+		{code: http.StatusInternalServerError, retry: true},
+		{code: http.StatusServiceUnavailable, retry: true},
+		{code: http.StatusBadRequest, retry: false},
+		{code: http.StatusUnauthorized, retry: false},
+		{code: http.StatusRequestEntityTooLarge, retry: false},
+	}
+	for _, tc := range cases {
+		_, retry := p.NextRetry(RetryAttempt{Attempt: 1, HTTPCode: tc.code, Err: tc.err})
+		require.Equal(t, tc.retry, retry, "code=%d err=%v", tc.code, tc.err)
+	}
+
+	_, retry := p.NextRetry(RetryAttempt{Attempt: 4, HTTPCode: http.StatusBadGateway})
+	require.False(t, retry, "max retries exceeded")
+}
+
+func TestDefaultRetryPolicyJitterAndBudget(t *testing.T) {
+	p := DefaultRetryPolicy{MaxRetries: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Budget: 2 * time.Second}
+	for attempt := 1; attempt <= 10; attempt++ {
+		delay, retry := p.NextRetry(RetryAttempt{Attempt: attempt, HTTPCode: http.StatusBadGateway})
+		require.True(t, retry)
+		require.Greater(t, delay, time.Duration(0))
+		require.LessOrEqual(t, delay, time.Second)
+	}
+
+	_, retry := p.NextRetry(RetryAttempt{Attempt: 1, HTTPCode: http.StatusBadGateway, Elapsed: 2 * time.Second})
+	require.False(t, retry, "budget exhausted")
+}
+
+func TestDefaultRetryPolicyRetryAfter(t *testing.T) {
+	p := DefaultRetryPolicy{MaxRetries: 2, Budget: 10 * time.Second}
+
+	header := http.Header{}
+	header.Set("Retry-After", "3")
+	delay, retry := p.NextRetry(RetryAttempt{Attempt: 1, HTTPCode: http.StatusTooManyRequests, Header: header})
+	require.True(t, retry)
+	require.Equal(t, 3*time.Second, delay)
+
+	header.Set("Retry-After", "30")
+	_, retry = p.NextRetry(RetryAttempt{Attempt: 1, HTTPCode: http.StatusTooManyRequests, Header: header})
+	require.False(t, retry, "Retry-After beyond budget")
+
+	now := time.Now()
+	header.Set("Retry-After", now.Add(5*time.Second).UTC().Format(http.TimeFormat))
+	d, ok := retryAfter(header, now)
+	require.True(t, ok)
+	require.InDelta(t, float64(5*time.Second), float64(d), float64(time.Second))
+}
+
+func TestHTTPClientDoRetriesOnlyRetryableStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		calls  int
+	}{
+		{status: http.StatusBadRequest, calls: 1},
+		{status: http.StatusUnauthorized, calls: 1},
+		{status: http.StatusServiceUnavailable, calls: 3},
+	} {
+		transport := &stubTransport{status: tc.status}
+		h := &httpClient{client: &http.Client{Transport: transport}}
+		opts := newRequestOpts().WithMethod("POST").WithURL("http://example.com/in/track").
+			WithRetryPolicy(DefaultRetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond})
+
+		_, code, err := h.Do(context.Background(), opts)
+		require.NoError(t, err)
+		require.Equal(t, tc.status, code)
+		require.Equal(t, tc.calls, transport.calls, "status %d", tc.status)
+	}
+}
@@ -2,6 +2,7 @@ package sensorswave
 
 import (
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
@@ -78,8 +79,13 @@ func hmacSHA256Hex(key, data string) string {
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// generateNonce returns 128 random bits, hex encoded.
 func generateNonce() string {
-	return fmt.Sprintf("%d", time.Now().UnixNano())
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil { // never fails on supported platforms
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
 }
 
 func buildCanonicalRequest(method, uri, queryString string, headers map[string]string, hashedPayload string) string {
@@ -1,9 +1,15 @@
 package sensorswave
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -165,3 +171,68 @@ func TestSignatureWithPrecomputedHash(t *testing.T) {
 
 	require.Equal(t, clientAuth, serverAuth, "Precomputed hash should produce matching signatures")
 }
+
+func TestSignedTrackRequests(t *testing.T) {
+	type signedRequest struct {
+		nonce, auth, wantAuth, sha, wantSHA string
+	}
+	var (
+		mu       sync.Mutex
+		requests []signedRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		headers := map[string]string{
+			"Content-Type":     r.Header.Get("Content-Type"),
+			HeaderSourceToken:  r.Header.Get(HeaderSourceToken),
+			"x-auth-timestamp": r.Header.Get("x-auth-timestamp"),
+			"x-auth-nonce":     r.Header.Get("x-auth-nonce"),
+		}
+
+		mu.Lock()
+		requests = append(requests, signedRequest{
+			nonce:    r.Header.Get("x-auth-nonce"),
+			auth:     r.Header.Get("Authorization"),
+			wantAuth: SignRequest("POST", "/in/track", "", headers, body, "test-token", "test-secret"),
+			sha:      r.Header.Get("x-content-sha256"),
+			wantSHA:  sha256Hex(body),
+		})
+		first := len(requests) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := Config{
+		Logger:            &noopLogger{},
+		FlushInterval:     time.Hour,
+		RetryPolicy:       DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+		SignTrackRequests: true,
+		ProjectSecret:     "test-secret",
+	}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon"}, "Signed", nil))
+	require.NoError(t, c.Flush(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requests, 2)
+	for _, req := range requests {
+		require.Equal(t, req.wantAuth, req.auth)
+		require.Equal(t, req.wantSHA, req.sha)
+	}
+	require.NotEqual(t, requests[0].nonce, requests[1].nonce)
+}
+
+func TestSignTrackRequestsRequiresSecret(t *testing.T) {
+	_, err := NewWithConfig(Endpoint("http://test.example.com"), SourceToken("test-token"),
+		Config{Logger: &noopLogger{}, SignTrackRequests: true})
+	require.Error(t, err)
+}
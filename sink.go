@@ -0,0 +1,287 @@
+package sensorswave
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sink is an additional destination for tracked events, such as a file or a
+// company pipeline. Each sink gets every event the client sends, after
+// validation, interceptors and redaction, in its own batches.
+type Sink interface {
+	// Name identifies the sink in logs and errors.
+	Name() string
+
+	// WriteBatch writes encoded events. A returned error makes the batch be retried
+	// according to SinkConfig.RetryPolicy; an *HTTPStatusError carries its status
+	// to the policy, and a *RejectedError is never retried. A *PartialWriteError
+	// reports only its events as failed, without a retry.
+	WriteBatch(ctx context.Context, events []json.RawMessage) error
+
+	// Close releases the sink after its last batch.
+	Close() error
+}
+
+// SinkConfig adds a Sink to the client with its own queue, batching and retries.
+// A slow or failing sink never blocks tracking or the other sinks.
+type SinkConfig struct {
+	// Sink receives the events. In a Pool template it is shared by all projects
+	// and closed when the Pool closes.
+	Sink Sink
+
+	// NewSink creates the sink instead of Sink. In a Pool it is called for every
+	// project, so each project writes to its own sink, closed with the project.
+	NewSink func(token SourceToken) (Sink, error)
+
+	// QueueSize is the number of events buffered for the sink; events that don't fit are dropped. Default: 1000
+	QueueSize int
+
+	// MaxBatchSize is the maximum number of events per WriteBatch. Default: Config.MaxBatchSize
+	MaxBatchSize int
+
+	// FlushInterval is the interval for writing partial batches. Default: Config.FlushInterval
+	FlushInterval time.Duration
+
+	// RetryPolicy decides which failed batches are written again.
+	// Default: DefaultRetryPolicy with 2 retries and a 30s budget
+	RetryPolicy RetryPolicy
+
+	// OnError is called with the events of a batch that could not be written.
+	OnError func(sink string, events []json.RawMessage, err error)
+}
+
+// sink default
+const defaultSinkQueueSize = 1000
+
+// sinkWorker batches and writes the events of one sink.
+type sinkWorker struct {
+	cfg    SinkConfig
+	name   string
+	logger Logger
+	owned  bool // the sink is closed with the worker, false for a Pool's shared sinks
+
+	written func(events []json.RawMessage) // called after each successful write, may be nil
+
+	msgs     chan []byte
+	flushReq chan chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+	ctx      context.Context // cancelled when close gives up
+	cancel   context.CancelFunc
+
+	closeOnce sync.Once
+	dropped   atomic.Uint64
+}
+
+// newSinkWorker applies the defaults to cfg and starts its worker. cfg.Sink must be set.
+func newSinkWorker(cfg SinkConfig, clientCfg *Config, owned bool, written func(events []json.RawMessage)) *sinkWorker {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultSinkQueueSize
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = clientCfg.MaxBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = clientCfg.FlushInterval
+	}
+	if cfg.RetryPolicy == nil {
+		cfg.RetryPolicy = DefaultRetryPolicy{
+			MaxRetries: 2,
+			BaseDelay:  defaultRetryBaseDelay,
+			MaxDelay:   defaultRetryMaxDelay,
+			Budget:     defaultRetryBudget,
+		}
+	}
+
+	w := &sinkWorker{
+		cfg:      cfg,
+		name:     cfg.Sink.Name(),
+		logger:   clientCfg.Logger,
+		owned:    owned,
+		written:  written,
+		msgs:     make(chan []byte, cfg.QueueSize),
+		flushReq: make(chan chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	go w.loop()
+	return w
+}
+
+// offer queues msg without blocking; it is dropped, and false returned, if the sink is behind.
+func (w *sinkWorker) offer(msg []byte) bool {
+	select {
+	case w.msgs <- msg:
+		return true
+	default:
+		if total := w.dropped.Add(1); total == 1 || total%1000 == 0 {
+			w.logger.Warnf("sink %s queue full, dropped %d events", w.name, total)
+		}
+		return false
+	}
+}
+
+// put queues msg, waiting while the queue is full. It returns false if ctx ends first.
+func (w *sinkWorker) put(ctx context.Context, msg []byte) bool {
+	select {
+	case w.msgs <- msg:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// flush writes everything queued so far.
+func (w *sinkWorker) flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case w.flushReq <- done:
+	case <-w.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close writes the remaining events and closes the sink if the worker owns it.
+// When ctx ends first, the current write is aborted.
+func (w *sinkWorker) close(ctx context.Context) (err error) {
+	w.closeOnce.Do(func() {
+		close(w.quit)
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			w.cancel()
+			<-w.done
+		}
+		w.cancel()
+		if !w.owned {
+			return
+		}
+		if cerr := w.cfg.Sink.Close(); cerr != nil {
+			w.logger.Errorf("sink %s close error: %v", w.name, cerr)
+			if err == nil {
+				err = cerr
+			}
+		}
+	})
+	return err
+}
+
+func (w *sinkWorker) loop() {
+	defer close(w.done)
+
+	tick := time.NewTicker(w.cfg.FlushInterval)
+	defer tick.Stop()
+
+	batch := make([]json.RawMessage, 0, w.cfg.MaxBatchSize)
+	write := func() {
+		if len(batch) > 0 {
+			w.write(batch)
+			batch = make([]json.RawMessage, 0, w.cfg.MaxBatchSize)
+		}
+	}
+	add := func(msg []byte) {
+		batch = append(batch, msg)
+		if len(batch) >= w.cfg.MaxBatchSize {
+			write()
+		}
+	}
+
+	for {
+		select {
+		case msg := <-w.msgs:
+			add(msg)
+		case <-tick.C:
+			write()
+			w.expire()
+		case done := <-w.flushReq:
+			for n := len(w.msgs); n > 0; n-- {
+				add(<-w.msgs)
+			}
+			write()
+			close(done)
+		case <-w.quit:
+			for n := len(w.msgs); n > 0; n-- {
+				add(<-w.msgs)
+			}
+			write()
+			return
+		}
+	}
+}
+
+// expirer is implemented by sinks that complete their output by age, such as
+// the file sink. The worker calls expire on every flush tick, so idle output
+// isn't held open past its age.
+type expirer interface {
+	expire() error
+}
+
+func (w *sinkWorker) expire() {
+	if e, ok := w.cfg.Sink.(expirer); ok {
+		if err := e.expire(); err != nil {
+			w.logger.Errorf("sink %s rotate error: %v", w.name, err)
+		}
+	}
+}
+
+// write writes one batch with retries. Failures are logged and reported, never propagated.
+func (w *sinkWorker) write(batch []json.RawMessage) {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := w.writeOnce(batch)
+		if err == nil {
+			if w.written != nil {
+				w.written(batch)
+			}
+			return
+		}
+		var partialErr *PartialWriteError
+		if errors.As(err, &partialErr) {
+			w.logger.Errorf("sink %s dropped %d of %d events: %v", w.name, len(partialErr.Events), len(batch), partialErr.Err)
+			if w.cfg.OnError != nil {
+				w.cfg.OnError(w.name, partialErr.Events, partialErr.Err)
+			}
+			return
+		}
+
+		retry := RetryAttempt{Attempt: attempt, Err: err, Elapsed: time.Since(start)}
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) {
+			retry.HTTPCode, retry.Err = statusErr.Code, nil
+		}
+		var rejectedErr *RejectedError
+		delay, ok := w.cfg.RetryPolicy.NextRetry(retry)
+		if errors.As(err, &rejectedErr) || !ok || !sleepContext(w.ctx, delay) {
+			w.logger.Errorf("sink %s dropped %d events after %d attempts: %v", w.name, len(batch), attempt, err)
+			if w.cfg.OnError != nil {
+				w.cfg.OnError(w.name, batch, err)
+			}
+			return
+		}
+	}
+}
+
+// writeOnce calls WriteBatch, turning a panic into an error.
+func (w *sinkWorker) writeOnce(batch []json.RawMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sink %s panic: %v", w.name, r)
+		}
+	}()
+	return w.cfg.Sink.WriteBatch(w.ctx, batch)
+}
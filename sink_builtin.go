@@ -0,0 +1,360 @@
+package sensorswave
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ========== HTTP ==========
+
+// HTTPSinkConfig configures a sink that posts batches to a SensorsWave track endpoint,
+// e.g. to mirror events into a second project.
+type HTTPSinkConfig struct {
+	Endpoint Endpoint
+	Token    SourceToken
+
+	// ProjectSecret of the destination project, required if SignRequests is set.
+	ProjectSecret string
+
+	// SignRequests signs every request like Config.SignTrackRequests.
+	SignRequests bool
+
+	// URIPath is the track path. Default: "/in/track"
+	URIPath string
+
+	// Timeout is the timeout of each request. Default: 3s
+	Timeout time.Duration
+
+	// Compression encodes request bodies. Default: CompressionNone
+	Compression Compression
+
+	// HTTPDoer sends the requests instead of net/http with DefaultHTTPTransport.
+	HTTPDoer HTTPDoer
+
+	// Logger receives the sink's request errors. Default: the SDK default logger, which prints to stdout
+	Logger Logger
+}
+
+// httpSink delivers batches with a client that has no queue of its own, so the
+// requests are compressed, signed, split on 413 and checked for per-event
+// rejections exactly like the client's own track requests.
+type httpSink struct {
+	url    string
+	sender *client
+
+	mu     sync.Mutex        // one batch at a time, failed is per batch
+	failed []json.RawMessage // events the current batch lost
+	errs   []error
+}
+
+// NewHTTPSink creates a sink that sends batches like the client's own track requests.
+// Failed requests are retried by SinkConfig.RetryPolicy; events the server rejected
+// are reported to SinkConfig.OnError without a retry.
+func NewHTTPSink(cfg HTTPSinkConfig) (Sink, error) {
+	endpoint, err := normalizeEndpoint(string(cfg.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("http sink endpoint is required")
+	}
+	if cfg.URIPath, err = normalizeURIPath(cfg.URIPath, defaultTrackPath); err != nil {
+		return nil, err
+	}
+	if cfg.SignRequests && cfg.ProjectSecret == "" {
+		return nil, fmt.Errorf("http sink project secret is required when SignRequests is set")
+	}
+
+	senderCfg := Config{
+		TrackURIPath:      cfg.URIPath,
+		HTTPTimeout:       cfg.Timeout,
+		Compression:       cfg.Compression,
+		HTTPDoer:          cfg.HTTPDoer,
+		ProjectSecret:     cfg.ProjectSecret,
+		SignTrackRequests: cfg.SignRequests,
+		Logger:            cfg.Logger,
+		RetryPolicy:       DefaultRetryPolicy{}, // the sink worker retries failed batches
+	}
+	normalizeConfig(&senderCfg)
+	s := &httpSink{url: endpoint + cfg.URIPath}
+	s.sender = &client{
+		endpoint:    endpoint,
+		sourceToken: string(cfg.Token),
+		cfg:         &senderCfg,
+		h:           NewHTTPClientWithDoer(nil, cfg.HTTPDoer),
+		onFailed:    s.recordFailed,
+	}
+	return s, nil
+}
+
+func (s *httpSink) Name() string {
+	return "http:" + s.url
+}
+
+func (s *httpSink) WriteBatch(ctx context.Context, events []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed, s.errs = nil, nil
+
+	s.sender.deliver(ctx, joinBatch(events), false)
+	switch {
+	case len(s.errs) == 0:
+		return nil
+	case len(s.errs) == 1 && len(s.failed) == len(events): // the whole batch, retry it
+		return s.errs[0]
+	default:
+		return &PartialWriteError{Events: s.failed, Err: errors.Join(s.errs...)}
+	}
+}
+
+// recordFailed collects the events the sender gave up on for WriteBatch.
+func (s *httpSink) recordFailed(jsonBody []byte, err error) {
+	msgs, _, serr := splitBatch(jsonBody)
+	if serr != nil {
+		s.sender.cfg.Logger.Errorf("split failed sink batch error: %v", serr)
+	}
+	s.failed = append(s.failed, msgs...)
+	s.errs = append(s.errs, err)
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
+
+// ========== File ==========
+
+// FileSinkConfig configures a sink that writes events as newline-delimited JSON files.
+// A file is written under a ".part" name and renamed when it is complete.
+type FileSinkConfig struct {
+	// Dir is created if missing.
+	Dir string
+
+	// Prefix starts every file name, followed by the UTC creation time. Default: "events"
+	Prefix string
+
+	// MaxBytes starts a new file once this many uncompressed bytes were written to it. Default: 64MB
+	MaxBytes int64
+
+	// MaxAge starts a new file once the current one is this old. Default: 1h
+	// In Config.Sinks or Config.Export, an idle file is also completed on the
+	// first flush tick after it reaches MaxAge.
+	MaxAge time.Duration
+
+	// Gzip compresses the files, named ".ndjson.gz" instead of ".ndjson".
+	// Each batch is a separate gzip member, which gzip readers join transparently.
+	Gzip bool
+}
+
+// file sink default
+const (
+	defaultFileSinkPrefix   = "events"
+	defaultFileSinkMaxBytes = 64 << 20
+	defaultFileSinkMaxAge   = time.Hour
+	fileSinkExt             = ".ndjson"
+	fileSinkGzipExt         = ".ndjson.gz"
+	fileSinkPartExt         = ".part"
+)
+
+// sinkFile is the part of *os.File used by fileSink.
+type sinkFile interface {
+	io.WriteCloser
+	Name() string
+	Sync() error
+	Truncate(size int64) error
+}
+
+type fileSink struct {
+	cfg FileSinkConfig
+
+	mu      sync.Mutex
+	file    sinkFile
+	name    string // final name of file
+	size    int64  // uncompressed bytes
+	offset  int64  // bytes in file, always at the end of a batch
+	created time.Time
+}
+
+// NewFileSink creates a sink that appends events to rotating NDJSON files, one event per line.
+func NewFileSink(cfg FileSinkConfig) (Sink, error) {
+	return newFileSink(cfg)
+}
+
+func newFileSink(cfg FileSinkConfig) (*fileSink, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("file sink dir is required")
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = defaultFileSinkPrefix
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultFileSinkMaxBytes
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultFileSinkMaxAge
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &fileSink{cfg: cfg}, nil
+}
+
+func (s *fileSink) Name() string {
+	return "file:" + filepath.Join(s.cfg.Dir, s.cfg.Prefix)
+}
+
+// WriteBatch appends events as one write. Gzip files get one gzip member per
+// batch, so a failed write can be cut off without breaking the earlier batches.
+func (s *fileSink) WriteBatch(ctx context.Context, events []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil && (s.size >= s.cfg.MaxBytes || time.Since(s.created) >= s.cfg.MaxAge) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	lines := ndjson(events)
+	data := lines
+	if s.cfg.Gzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(lines); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	n, err := s.file.Write(data)
+	if err != nil {
+		return s.discardPartial(n, err)
+	}
+	s.size += int64(len(lines))
+	s.offset += int64(n)
+	return nil
+}
+
+// discardPartial cuts a partly written batch off the current file, so a retry
+// doesn't follow a broken line. If that fails, the file is abandoned under its
+// ".part" name and the next write starts a new one.
+func (s *fileSink) discardPartial(written int, err error) error {
+	if written == 0 {
+		return err
+	}
+	if terr := s.file.Truncate(s.offset); terr != nil {
+		f := s.file
+		s.file = nil
+		f.Close()
+		return fmt.Errorf("%w; abandoned %s: %v", err, f.Name(), terr)
+	}
+	return err
+}
+
+// expire completes the current file once it is MaxAge old, even if nothing
+// more was written to it.
+func (s *fileSink) expire() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil || time.Since(s.created) < s.cfg.MaxAge {
+		return nil
+	}
+	return s.rotate()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rotate()
+}
+
+func (s *fileSink) open() error {
+	now := time.Now()
+	ext := fileSinkExt
+	if s.cfg.Gzip {
+		ext = fileSinkGzipExt
+	}
+	name := filepath.Join(s.cfg.Dir, fmt.Sprintf("%s-%s%s", s.cfg.Prefix, now.UTC().Format("20060102T150405.000000000"), ext))
+	f, err := os.OpenFile(name+fileSinkPartExt, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.file, s.name, s.size, s.offset, s.created = f, name, 0, 0, now
+	return nil
+}
+
+// rotate completes the current file; the next write opens a new one.
+func (s *fileSink) rotate() error {
+	if s.file == nil {
+		return nil
+	}
+	f := s.file
+	s.file = nil
+
+	err := f.Sync()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.name)
+}
+
+// ========== Writer ==========
+
+type writerSink struct {
+	name string
+	mu   sync.Mutex
+	w    io.Writer
+}
+
+// NewWriterSink creates a sink that writes events to w, one JSON object per line.
+func NewWriterSink(name string, w io.Writer) Sink {
+	return &writerSink{name: name, w: w}
+}
+
+// NewStdoutSink creates a debug sink that prints every event to standard output.
+func NewStdoutSink() Sink {
+	return NewWriterSink("stdout", os.Stdout)
+}
+
+func (s *writerSink) Name() string {
+	return s.name
+}
+
+func (s *writerSink) WriteBatch(ctx context.Context, events []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.w.Write(ndjson(events))
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// ndjson joins events into newline-delimited JSON.
+func ndjson(events []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	for _, event := range events {
+		buf.Write(bytes.TrimSpace(event))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
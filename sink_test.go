@@ -0,0 +1,400 @@
+package sensorswave
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink records written batches and fails the first failures writes.
+type memorySink struct {
+	mu       sync.Mutex
+	batches  [][]json.RawMessage
+	failures int
+	panics   bool
+	closed   bool
+}
+
+func (s *memorySink) Name() string { return "memory" }
+
+func (s *memorySink) WriteBatch(ctx context.Context, events []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.panics {
+		panic("sink bug")
+	}
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	s.batches = append(s.batches, events)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *memorySink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, b := range s.batches {
+		n += len(b)
+	}
+	return n
+}
+
+func TestSinkFanOut(t *testing.T) {
+	var rec batchRecorder
+	srv := rec.server()
+	defer srv.Close()
+
+	good := &memorySink{failures: 1} // retried
+	broken := &memorySink{panics: true}
+	var failed atomic.Int64
+	c, err := NewWithConfig(Endpoint(srv.URL), "token", Config{
+		Logger: &noopLogger{},
+		Sinks: []SinkConfig{
+			{Sink: good, MaxBatchSize: 2},
+			{Sink: broken, RetryPolicy: DefaultRetryPolicy{MaxRetries: 1, BaseDelay: time.Millisecond},
+				OnError: func(sink string, events []json.RawMessage, err error) { failed.Add(int64(len(events))) }},
+		},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "Login", nil))
+	}
+	require.NoError(t, c.Flush(context.Background()))
+	require.Equal(t, 5, good.count())
+	require.Equal(t, []int{5}, rec.sizes(), "a failing sink doesn't affect the endpoint")
+	require.EqualValues(t, 5, failed.Load())
+
+	require.NoError(t, c.Close())
+	require.True(t, good.closed)
+	require.True(t, broken.closed)
+}
+
+func TestSinksOnlyClient(t *testing.T) {
+	var buf bytes.Buffer
+	c, err := NewWithConfig("", "token", Config{
+		Logger: &noopLogger{},
+		Sinks:  []SinkConfig{{Sink: NewWriterSink("buffer", &buf)}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "Login", nil))
+	require.NoError(t, c.TrackEvent(User{LoginID: "u2"}, "Login", nil))
+	require.NoError(t, c.Close())
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var evt Event
+	require.NoError(t, json.Unmarshal(lines[1], &evt))
+	require.Equal(t, "u2", evt.LoginID)
+
+	_, err = NewWithConfig("", "token", Config{Logger: &noopLogger{}, Sinks: []SinkConfig{{}}})
+	require.Error(t, err)
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileSink(FileSinkConfig{Dir: dir, Prefix: "ev", MaxBytes: 10})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, s.WriteBatch(ctx, []json.RawMessage{json.RawMessage(`{"a":1}`), json.RawMessage(`{"a":2}`)}))
+	require.NoError(t, s.WriteBatch(ctx, []json.RawMessage{json.RawMessage(`{"a":3}`)}))
+	require.NoError(t, s.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "ev-*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+
+	var lines []string
+	for _, name := range files {
+		f, err := os.Open(name)
+		require.NoError(t, err)
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		require.NoError(t, f.Close())
+	}
+	require.ElementsMatch(t, []string{`{"a":1}`, `{"a":2}`, `{"a":3}`}, lines)
+}
+
+// shortFile writes half of each write to the underlying file and fails.
+type shortFile struct {
+	sinkFile
+}
+
+func (f shortFile) Write(p []byte) (int, error) {
+	n, _ := f.sinkFile.Write(p[:len(p)/2])
+	return n, errors.New("disk full")
+}
+
+func TestFileSinkDiscardsPartialWrites(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		dir := t.TempDir()
+		s, err := newFileSink(FileSinkConfig{Dir: dir, Gzip: gz})
+		require.NoError(t, err)
+
+		ctx := context.Background()
+		first := []json.RawMessage{json.RawMessage(`{"a":1}`)}
+		second := []json.RawMessage{json.RawMessage(`{"a":2}`), json.RawMessage(`{"a":3}`)}
+		require.NoError(t, s.WriteBatch(ctx, first))
+		file := s.file
+		s.file = shortFile{file}
+		require.Error(t, s.WriteBatch(ctx, second))
+		s.file = file
+		require.NoError(t, s.WriteBatch(ctx, second), "retried")
+		require.NoError(t, s.Close())
+
+		files, err := filepath.Glob(filepath.Join(dir, "events-*"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		f, err := os.Open(files[0])
+		require.NoError(t, err)
+		var r io.Reader = f
+		if gz {
+			zr, err := gzip.NewReader(f)
+			require.NoError(t, err)
+			r = zr
+		}
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.Equal(t, "{\"a\":1}\n{\"a\":2}\n{\"a\":3}\n", string(data), "gzip %v", gz)
+	}
+}
+
+// failOnceFile fails its first write halfway.
+type failOnceFile struct {
+	sinkFile
+	failed *atomic.Bool
+}
+
+func (f failOnceFile) Write(p []byte) (int, error) {
+	if f.failed.CompareAndSwap(false, true) {
+		return shortFile{f.sinkFile}.Write(p)
+	}
+	return f.sinkFile.Write(p)
+}
+
+func TestExportRetriesFailedWrites(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newClient("", "token", Config{Logger: &noopLogger{}, FlushInterval: time.Hour, Export: &FileSinkConfig{Dir: dir}}, nil)
+	require.NoError(t, err)
+	user := User{LoginID: "u1"}
+	require.NoError(t, c.TrackEvent(user, "First", nil))
+	require.NoError(t, c.Flush(context.Background()))
+
+	fs := c.export.cfg.Sink.(*fileSink)
+	var failed atomic.Bool
+	fs.mu.Lock()
+	fs.file = failOnceFile{fs.file, &failed}
+	fs.mu.Unlock()
+	require.NoError(t, c.TrackEvent(user, "Second", nil))
+	require.NoError(t, c.Flush(context.Background()))
+	require.True(t, failed.Load())
+
+	st := c.Stats()
+	require.EqualValues(t, 2, st.EventsSent)
+	require.Zero(t, st.EventsFailed)
+	require.NoError(t, c.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "events-*.ndjson"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	require.Len(t, lines, 2)
+}
+
+// brokenFile fails every write.
+type brokenFile struct {
+	sinkFile
+}
+
+func (f brokenFile) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestExportBackpressure(t *testing.T) {
+	c, err := newClient("", "token", Config{
+		Logger:        &noopLogger{},
+		FlushInterval: time.Hour,
+		MaxQueueSize:  2,
+		MaxBatchSize:  1,
+		QueuePolicy:   QueueDropNewest,
+		Export:        &FileSinkConfig{Dir: t.TempDir()},
+	}, nil)
+	require.NoError(t, err)
+	user := User{LoginID: "u1"}
+	require.NoError(t, c.TrackEvent(user, "First", nil))
+	require.NoError(t, c.Flush(context.Background()))
+
+	fs := c.export.cfg.Sink.(*fileSink)
+	fs.mu.Lock()
+	fs.file = brokenFile{fs.file}
+	fs.mu.Unlock()
+
+	// The export retries the first batch, so the queues fill and the policy drops the rest
+	var dropped uint64
+	for i := 0; i < 20; i++ {
+		if errors.Is(c.TrackEvent(user, "Stuck", nil), ErrTooManyRequests) {
+			dropped++
+		}
+	}
+	require.NotZero(t, dropped)
+	require.Equal(t, dropped, c.DroppedEvents())
+
+	require.NoError(t, c.Close())
+	st := c.Stats()
+	require.EqualValues(t, 1, st.EventsSent)
+	require.Equal(t, 20-dropped, st.EventsFailed, "retried until Close, then reported")
+}
+
+func TestExportCompletesIdleFiles(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newClient("", "token", Config{
+		Logger:        &noopLogger{},
+		FlushInterval: 20 * time.Millisecond,
+		Export:        &FileSinkConfig{Dir: dir, MaxAge: 50 * time.Millisecond},
+	}, nil)
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "Login", nil))
+
+	require.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "events-*.ndjson"))
+		return len(files) == 1
+	}, time.Second, 10*time.Millisecond, "the file is renamed without another write")
+	parts, err := filepath.Glob(filepath.Join(dir, "*.part"))
+	require.NoError(t, err)
+	require.Empty(t, parts)
+}
+
+func TestHTTPSink(t *testing.T) {
+	var rec batchRecorder
+	srv := rec.server()
+	defer srv.Close()
+
+	s, err := NewHTTPSink(HTTPSinkConfig{Endpoint: Endpoint(srv.URL), Token: "mirror"})
+	require.NoError(t, err)
+	event := NewEvent("", "u1", "Login")
+	require.NoError(t, event.Normalize())
+	require.NoError(t, s.WriteBatch(context.Background(), []json.RawMessage{event.Bytes()}))
+	require.Equal(t, []int{1}, rec.sizes())
+
+	_, err = NewHTTPSink(HTTPSinkConfig{})
+	require.Error(t, err)
+}
+
+func TestHTTPSinkDeliversLikeTheClient(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		sizes    []int
+		verified []error
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, verr := VerifyRequest(r, func(token string) (string, bool) { return "mirror-secret", token == "mirror" })
+		var events []Event
+		_ = json.NewDecoder(r.Body).Decode(&events)
+		mu.Lock()
+		sizes = append(sizes, len(events))
+		verified = append(verified, verr)
+		mu.Unlock()
+		if len(events) > 2 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		for _, e := range events {
+			if e.Event == "Bad" {
+				fmt.Fprintf(w, `{"code":0,"data":{"rejected":[{"trace_id":%q,"reason":"invalid"}]}}`, e.TraceID)
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	s, err := NewHTTPSink(HTTPSinkConfig{Endpoint: Endpoint(srv.URL), Token: "mirror", ProjectSecret: "mirror-secret", SignRequests: true, Logger: &noopLogger{}})
+	require.NoError(t, err)
+	var batch []json.RawMessage
+	for _, name := range []string{"A", "B", "Bad", "C"} {
+		event := NewEvent("", "u1", name)
+		require.NoError(t, event.Normalize())
+		batch = append(batch, event.Bytes())
+	}
+
+	err = s.WriteBatch(context.Background(), batch)
+	var partial *PartialWriteError
+	require.ErrorAs(t, err, &partial)
+	require.Equal(t, []json.RawMessage{batch[2]}, partial.Events)
+	require.ErrorIs(t, err, ErrEventRejected)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int{4, 2, 2}, sizes, "split on 413")
+	for _, verr := range verified {
+		require.NoError(t, verr)
+	}
+
+	_, err = NewHTTPSink(HTTPSinkConfig{Endpoint: Endpoint(srv.URL), SignRequests: true})
+	require.Error(t, err, "signing needs the project secret")
+}
+
+func TestExportMode(t *testing.T) {
+	dir := t.TempDir()
+	var rec batchRecorder
+	srv := rec.server()
+	defer srv.Close()
+
+	c, err := NewWithConfig(Endpoint(srv.URL), "token", Config{
+		Logger: &noopLogger{},
+		Export: &FileSinkConfig{Dir: dir, Gzip: true},
+	})
+	require.NoError(t, err)
+	require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "Login", nil))
+	require.NoError(t, c.Flush(context.Background()))
+
+	parts, err := filepath.Glob(filepath.Join(dir, "*.ndjson.gz.part"))
+	require.NoError(t, err)
+	require.Len(t, parts, 1, "open file keeps its .part name")
+
+	require.NoError(t, c.Close())
+	require.Empty(t, rec.sizes(), "nothing is sent in export mode")
+
+	files, err := filepath.Glob(filepath.Join(dir, "events-*.ndjson.gz"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	var evt Event
+	require.NoError(t, json.NewDecoder(gz).Decode(&evt))
+	require.Equal(t, "u1", evt.LoginID)
+	require.Equal(t, "Login", evt.Event)
+}
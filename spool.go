@@ -0,0 +1,548 @@
+package sensorswave
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpoolConfig enables a durable on-disk log for event batches.
+//
+// Every batch is appended to a segmented log before it is sent and is
+// acknowledged once the server accepted it or rejected it for good. Batches
+// that failed with a retryable error are resent every RetryInterval, and
+// batches still in the log when a new client starts are replayed.
+type SpoolConfig struct {
+	// Dir is the directory holding the spool segments. Required.
+	Dir string
+
+	// MaxBytes is the upper limit of all segments on disk. When exceeded, the
+	// oldest segments are discarded. Default: 256MB
+	MaxBytes int64
+
+	// MaxAge discards segments whose last write is older than this. Default: 7 days
+	MaxAge time.Duration
+
+	// SegmentBytes is the size at which the active segment is rotated. Default: 16MB
+	SegmentBytes int64
+
+	// Fsync syncs the active segment after every write.
+	Fsync bool
+
+	// RetryInterval is the interval for resending batches that failed with a retryable error. Default: 30s
+	RetryInterval time.Duration
+}
+
+// spool config default
+const (
+	defaultSpoolMaxBytes      = 256 * 1024 * 1024
+	defaultSpoolMaxAge        = 7 * 24 * time.Hour
+	defaultSpoolSegmentBytes  = 16 * 1024 * 1024
+	defaultSpoolRetryInterval = 30 * time.Second
+
+	spoolSegmentExt = ".seg"
+)
+
+// spool record types
+const (
+	spoolRecBatch byte = 1
+	spoolRecAck   byte = 2
+)
+
+// spoolRecHeaderSize is type(1) + length(4) + crc32(4).
+const spoolRecHeaderSize = 9
+
+// spoolID identifies a batch record by its segment and offset.
+type spoolID struct {
+	seg uint64
+	off int64
+}
+
+// spoolBatch is a batch that has not been acknowledged yet.
+type spoolBatch struct {
+	id   spoolID
+	body []byte
+}
+
+// spoolSegment keeps the in-memory state of a segment file.
+type spoolSegment struct {
+	seq     uint64
+	size    int64
+	modTime time.Time
+	pending map[int64]int // payload sizes of unacknowledged batches by offset
+}
+
+// spool is a segmented append-only log of event batches.
+type spool struct {
+	mu       sync.Mutex
+	cfg      SpoolConfig
+	logger   Logger
+	segments []*spoolSegment // ordered by seq, last one is active
+	active   *os.File
+	replay   []spoolBatch
+	failed   map[spoolID]struct{} // pending batches to resend
+	moved    map[spoolID]spoolID  // batches copied forward by relocate
+	closed   bool
+}
+
+func normalizeSpoolConfig(cfg *SpoolConfig) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultSpoolMaxBytes
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultSpoolMaxAge
+	}
+	if cfg.SegmentBytes <= 0 {
+		cfg.SegmentBytes = defaultSpoolSegmentBytes
+	}
+	if cfg.SegmentBytes > cfg.MaxBytes {
+		cfg.SegmentBytes = cfg.MaxBytes
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultSpoolRetryInterval
+	}
+}
+
+// openSpool opens or creates the spool directory and loads the batches left
+// from previous runs. They can be fetched once with takeReplay.
+func openSpool(cfg SpoolConfig, logger Logger) (*spool, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("spool dir is required")
+	}
+	normalizeSpoolConfig(&cfg)
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("create spool dir: %w", err)
+	}
+
+	s := &spool{
+		cfg:    cfg,
+		logger: logger,
+		failed: make(map[spoolID]struct{}),
+		moved:  make(map[spoolID]spoolID),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load scans existing segments, drops expired ones and collects pending batches.
+func (s *spool) load() error {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("read spool dir: %w", err)
+	}
+
+	seqs := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+
+	bodies := make(map[spoolID][]byte)
+	acks := make([]spoolID, 0)
+	for _, seq := range seqs {
+		path := s.segmentPath(seq)
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > s.cfg.MaxAge {
+			s.logger.Warnf("spool segment %s expired, discarding", path)
+			_ = os.Remove(path)
+			continue
+		}
+
+		seg := &spoolSegment{seq: seq, size: info.Size(), modTime: info.ModTime(), pending: make(map[int64]int)}
+		err = readSpoolSegment(path, func(typ byte, off int64, payload []byte) {
+			switch typ {
+			case spoolRecBatch:
+				seg.pending[off] = len(payload)
+				bodies[spoolID{seg: seq, off: off}] = payload
+			case spoolRecAck:
+				if id, ok := decodeSpoolAck(payload); ok {
+					acks = append(acks, id)
+				}
+			}
+		})
+		if err != nil {
+			s.logger.Warnf("spool segment %s read error: %v", path, err)
+		}
+		s.segments = append(s.segments, seg)
+	}
+
+	for _, id := range acks {
+		if seg := s.segment(id.seg); seg != nil {
+			delete(seg.pending, id.off)
+		}
+		delete(bodies, id)
+	}
+
+	for _, seg := range s.segments {
+		offs := make([]int64, 0, len(seg.pending))
+		for off := range seg.pending {
+			offs = append(offs, off)
+		}
+		sort.Slice(offs, func(i, j int) bool { return offs[i] < offs[j] })
+		for _, off := range offs {
+			id := spoolID{seg: seg.seq, off: off}
+			s.replay = append(s.replay, spoolBatch{id: id, body: bodies[id]})
+		}
+	}
+
+	s.compact()
+	return nil
+}
+
+// readSpoolSegment calls fn for every intact record of a segment.
+// A truncated or corrupt tail (e.g. after a crash) ends the scan.
+func readSpoolSegment(path string, fn func(typ byte, off int64, payload []byte)) error {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var off int64
+	header := make([]byte, spoolRecHeaderSize)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("truncated record header at %d", off)
+		}
+		size := binary.BigEndian.Uint32(header[1:5])
+		sum := binary.BigEndian.Uint32(header[5:9])
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return fmt.Errorf("truncated record at %d", off)
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			return fmt.Errorf("checksum mismatch at %d", off)
+		}
+		fn(header[0], off, payload)
+		off += int64(spoolRecHeaderSize) + int64(size)
+	}
+}
+
+func encodeSpoolAck(id spoolID) []byte {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b[0:8], id.seg)
+	binary.BigEndian.PutUint64(b[8:16], uint64(id.off)) // #nosec G115
+	return b
+}
+
+func decodeSpoolAck(b []byte) (spoolID, bool) {
+	if len(b) != 16 {
+		return spoolID{}, false
+	}
+	return spoolID{
+		seg: binary.BigEndian.Uint64(b[0:8]),
+		off: int64(binary.BigEndian.Uint64(b[8:16])), // #nosec G115
+	}, true
+}
+
+// takeReplay returns the batches left over from previous runs. Subsequent calls return nil.
+func (s *spool) takeReplay() []spoolBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replay := s.replay
+	s.replay = nil
+	return replay
+}
+
+// append writes a batch to the active segment.
+func (s *spool) append(body []byte) (spoolID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return spoolID{}, ErrClosed
+	}
+
+	seg := s.segments[len(s.segments)-1]
+	if seg.size > 0 && seg.size+int64(spoolRecHeaderSize+len(body)) > s.cfg.SegmentBytes {
+		if err := s.rotate(); err != nil {
+			return spoolID{}, err
+		}
+		seg = s.segments[len(s.segments)-1]
+	}
+
+	id := spoolID{seg: seg.seq, off: seg.size}
+	if err := s.write(spoolRecBatch, body); err != nil {
+		return spoolID{}, err
+	}
+	seg.pending[id.off] = len(body)
+	s.enforceLimits()
+	return id, nil
+}
+
+// ack marks a batch as done, either delivered or failed for good. Segments
+// are removed from the oldest one on, once all their batches were acknowledged.
+func (s *spool) ack(id spoolID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+
+	id = s.resolve(id)
+	delete(s.failed, id)
+	seg := s.segment(id.seg)
+	if seg == nil {
+		return nil // already discarded
+	}
+	if _, ok := seg.pending[id.off]; !ok {
+		return nil
+	}
+	delete(seg.pending, id.off)
+	if err := s.write(spoolRecAck, encodeSpoolAck(id)); err != nil {
+		return err
+	}
+	s.compact()
+	return nil
+}
+
+// fail marks a batch that failed with a retryable error for takeFailed.
+func (s *spool) fail(id spoolID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id = s.resolve(id)
+	if seg := s.segment(id.seg); seg != nil {
+		if _, ok := seg.pending[id.off]; ok {
+			s.failed[id] = struct{}{}
+		}
+	}
+}
+
+// takeFailed returns the batches marked by fail since the last call, read back from disk.
+func (s *spool) takeFailed() []spoolBatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.failed) == 0 {
+		return nil
+	}
+
+	offs := make(map[uint64]map[int64]struct{})
+	for id := range s.failed {
+		if offs[id.seg] == nil {
+			offs[id.seg] = make(map[int64]struct{})
+		}
+		offs[id.seg][id.off] = struct{}{}
+	}
+	s.failed = make(map[spoolID]struct{})
+
+	var batches []spoolBatch
+	for _, seg := range s.segments {
+		want := offs[seg.seq]
+		if len(want) == 0 {
+			continue
+		}
+		err := readSpoolSegment(s.segmentPath(seg.seq), func(typ byte, off int64, payload []byte) {
+			if _, ok := want[off]; ok && typ == spoolRecBatch {
+				batches = append(batches, spoolBatch{id: spoolID{seg: seg.seq, off: off}, body: payload})
+			}
+		})
+		if err != nil {
+			s.logger.Warnf("spool segment %d read error: %v", seg.seq, err)
+		}
+	}
+	return batches
+}
+
+// resolve follows the copies made by relocate. The caller must hold mu.
+func (s *spool) resolve(id spoolID) spoolID {
+	for {
+		next, ok := s.moved[id]
+		if !ok {
+			return id
+		}
+		delete(s.moved, id)
+		id = next
+	}
+}
+
+// write appends one record to the active segment. The caller must hold mu.
+func (s *spool) write(typ byte, payload []byte) error {
+	buf := make([]byte, spoolRecHeaderSize+len(payload))
+	buf[0] = typ
+	binary.BigEndian.PutUint32(buf[1:5], uint32(len(payload))) // #nosec G115
+	binary.BigEndian.PutUint32(buf[5:9], crc32.ChecksumIEEE(payload))
+	copy(buf[spoolRecHeaderSize:], payload)
+
+	if _, err := s.active.Write(buf); err != nil {
+		return fmt.Errorf("spool write: %w", err)
+	}
+	if s.cfg.Fsync {
+		if err := s.active.Sync(); err != nil {
+			return fmt.Errorf("spool sync: %w", err)
+		}
+	}
+	seg := s.segments[len(s.segments)-1]
+	seg.size += int64(len(buf))
+	seg.modTime = time.Now()
+	return nil
+}
+
+// rotate closes the active segment and opens a new one. The caller must hold mu.
+func (s *spool) rotate() error {
+	var seq uint64 = 1
+	if n := len(s.segments); n > 0 {
+		seq = s.segments[n-1].seq + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open spool segment: %w", err)
+	}
+	if s.active != nil {
+		_ = s.active.Close()
+	}
+	s.active = f
+	s.segments = append(s.segments, &spoolSegment{seq: seq, modTime: time.Now(), pending: make(map[int64]int)})
+	s.compact()
+	return nil
+}
+
+// compact removes acknowledged segments, oldest first, but never the active
+// one. Acks for older segments live in newer ones, so segments are only
+// removed from the front. The few pending batches of a mostly acknowledged
+// segment are relocated, so they don't keep all newer segments on disk.
+func (s *spool) compact() {
+	for len(s.segments) > 1 {
+		if oldest := s.segments[0]; len(oldest.pending) > 0 && !s.relocate(oldest) {
+			return
+		}
+		s.removeOldest()
+	}
+}
+
+// relocate copies the pending batches of seg to the active segment, so seg can
+// be removed. It declines when a quarter or more of seg is still pending.
+func (s *spool) relocate(seg *spoolSegment) bool {
+	if s.active == nil { // still loading
+		return false
+	}
+	var pendingBytes int64
+	for _, n := range seg.pending {
+		pendingBytes += int64(spoolRecHeaderSize + n)
+	}
+	if pendingBytes*4 >= seg.size {
+		return false
+	}
+
+	bodies := make(map[int64][]byte, len(seg.pending))
+	err := readSpoolSegment(s.segmentPath(seg.seq), func(typ byte, off int64, payload []byte) {
+		if _, ok := seg.pending[off]; ok && typ == spoolRecBatch {
+			bodies[off] = payload
+		}
+	})
+	if err != nil || len(bodies) != len(seg.pending) {
+		s.logger.Warnf("spool segment %d relocate read error: %v", seg.seq, err)
+		return false
+	}
+
+	offs := make([]int64, 0, len(bodies))
+	for off := range bodies {
+		offs = append(offs, off)
+	}
+	sort.Slice(offs, func(i, j int) bool { return offs[i] < offs[j] })
+	active := s.segments[len(s.segments)-1]
+	for _, off := range offs {
+		to := spoolID{seg: active.seq, off: active.size}
+		if err := s.write(spoolRecBatch, bodies[off]); err != nil {
+			s.logger.Errorf("spool segment %d relocate error: %v", seg.seq, err)
+			return false
+		}
+		active.pending[to.off] = len(bodies[off])
+		delete(seg.pending, off)
+
+		from := spoolID{seg: seg.seq, off: off}
+		s.moved[from] = to
+		if _, ok := s.failed[from]; ok {
+			delete(s.failed, from)
+			s.failed[to] = struct{}{}
+		}
+	}
+	return true
+}
+
+// enforceLimits discards the oldest segments beyond MaxBytes and MaxAge.
+func (s *spool) enforceLimits() {
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		if s.totalBytes() <= s.cfg.MaxBytes && time.Since(oldest.modTime) <= s.cfg.MaxAge {
+			return
+		}
+		if n := len(oldest.pending); n > 0 {
+			s.logger.Warnf("spool limit reached, discarding segment %d with %d pending batches", oldest.seq, n)
+		}
+		s.removeOldest()
+	}
+}
+
+func (s *spool) removeOldest() {
+	oldest := s.segments[0]
+	if err := os.Remove(s.segmentPath(oldest.seq)); err != nil && !os.IsNotExist(err) {
+		s.logger.Warnf("spool remove segment %d error: %v", oldest.seq, err)
+	}
+	for id := range s.failed {
+		if id.seg == oldest.seq {
+			delete(s.failed, id)
+		}
+	}
+	s.segments = s.segments[1:]
+}
+
+func (s *spool) totalBytes() (total int64) {
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	return
+}
+
+func (s *spool) segment(seq uint64) *spoolSegment {
+	for _, seg := range s.segments {
+		if seg.seq == seq {
+			return seg
+		}
+	}
+	return nil
+}
+
+func (s *spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// close closes the active segment. Pending batches stay on disk for the next run.
+func (s *spool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.compact()
+	return s.active.Close()
+}
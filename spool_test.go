@@ -0,0 +1,208 @@
+package sensorswave
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolReplayUnacked(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, err := openSpool(SpoolConfig{Dir: dir}, &noopLogger{})
+	require.NoError(t, err)
+	require.Empty(t, sp.takeReplay())
+
+	id1, err := sp.append([]byte(`[{"event":"a"}]`))
+	require.NoError(t, err)
+	_, err = sp.append([]byte(`[{"event":"b"}]`))
+	require.NoError(t, err)
+	require.NoError(t, sp.ack(id1))
+	require.NoError(t, sp.close())
+
+	sp, err = openSpool(SpoolConfig{Dir: dir}, &noopLogger{})
+	require.NoError(t, err)
+	replay := sp.takeReplay()
+	require.Len(t, replay, 1)
+	require.Equal(t, `[{"event":"b"}]`, string(replay[0].body))
+
+	require.NoError(t, sp.ack(replay[0].id))
+	require.NoError(t, sp.close())
+
+	sp, err = openSpool(SpoolConfig{Dir: dir}, &noopLogger{})
+	require.NoError(t, err)
+	require.Empty(t, sp.takeReplay())
+	require.NoError(t, sp.close())
+}
+
+func TestSpoolRemovesAckedSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, err := openSpool(SpoolConfig{Dir: dir, SegmentBytes: 64}, &noopLogger{})
+	require.NoError(t, err)
+
+	body := []byte(`[{"event":"0123456789012345678901234567890123456789"}]`)
+	ids := make([]spoolID, 0, 4)
+	for i := 0; i < 4; i++ {
+		id, err := sp.append(body)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.Greater(t, len(sp.segments), 1)
+
+	for _, id := range ids {
+		require.NoError(t, sp.ack(id))
+	}
+	require.Len(t, sp.segments, 1)
+	require.NoError(t, sp.close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestSpoolMaxBytesDiscardsOldest(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, err := openSpool(SpoolConfig{Dir: dir, MaxBytes: 200, SegmentBytes: 64}, &noopLogger{})
+	require.NoError(t, err)
+
+	body := []byte(`[{"event":"0123456789012345678901234567890123456789"}]`)
+	for i := 0; i < 10; i++ {
+		_, err := sp.append(body)
+		require.NoError(t, err)
+	}
+	require.LessOrEqual(t, sp.totalBytes(), int64(200))
+	require.NoError(t, sp.close())
+}
+
+func TestSpoolRelocatesPendingBatches(t *testing.T) {
+	dir := t.TempDir()
+
+	sp, err := openSpool(SpoolConfig{Dir: dir, SegmentBytes: 400}, &noopLogger{})
+	require.NoError(t, err)
+
+	acked, err := sp.append([]byte(`[{"event":"acked"}]`))
+	require.NoError(t, err)
+	stuck, err := sp.append([]byte(`[{"event":"stuck"}]`))
+	require.NoError(t, err)
+	sp.fail(stuck)
+	for i := 0; i < 20; i++ {
+		id, err := sp.append([]byte(`[{"event":"ok"}]`))
+		require.NoError(t, err)
+		require.NoError(t, sp.ack(id))
+	}
+	require.Greater(t, sp.segments[0].seq, uint64(1), "pending batches don't pin acknowledged segments")
+
+	failed := sp.takeFailed()
+	require.Len(t, failed, 1)
+	require.Equal(t, `[{"event":"stuck"}]`, string(failed[0].body))
+	require.NoError(t, sp.ack(acked), "the original id acks the relocated copy")
+	require.NoError(t, sp.close())
+
+	sp, err = openSpool(SpoolConfig{Dir: dir}, &noopLogger{})
+	require.NoError(t, err)
+	replay := sp.takeReplay()
+	require.Len(t, replay, 1)
+	require.Equal(t, `[{"event":"stuck"}]`, string(replay[0].body))
+	require.NoError(t, sp.close())
+}
+
+func TestClientSpoolReplaysFailedBatches(t *testing.T) {
+	dir := t.TempDir()
+
+	var accept atomic.Bool
+	var delivered atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accept.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := Config{
+		Logger: &noopLogger{},
+		Spool:  &SpoolConfig{Dir: dir},
+	}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("token"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon"}, "Spooled", nil))
+	require.NoError(t, c.Close())
+	require.Equal(t, int32(0), delivered.Load())
+
+	accept.Store(true)
+	c, err = NewWithConfig(Endpoint(server.URL), SourceToken("token"), cfg)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return delivered.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, c.Close())
+
+	sp, err := openSpool(SpoolConfig{Dir: dir}, &noopLogger{})
+	require.NoError(t, err)
+	require.Empty(t, sp.takeReplay())
+	require.NoError(t, sp.close())
+}
+
+func TestClientSpoolAcksPermanentFailures(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	var failed atomic.Int32
+	cfg := Config{
+		Logger:             &noopLogger{},
+		Spool:              &SpoolConfig{Dir: dir},
+		OnTrackFailHandler: func(events []Event, err error) { failed.Add(int32(len(events))) },
+	}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("token"), cfg)
+	require.NoError(t, err)
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon"}, "Rejected", nil))
+	require.NoError(t, c.Close())
+	require.Equal(t, int32(1), failed.Load())
+
+	sp, err := openSpool(SpoolConfig{Dir: dir}, &noopLogger{})
+	require.NoError(t, err)
+	require.Empty(t, sp.takeReplay())
+	require.NoError(t, sp.close())
+}
+
+func TestClientSpoolRetriesWhileRunning(t *testing.T) {
+	var accept atomic.Bool
+	var delivered atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !accept.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var failed atomic.Int32
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("token"), Config{
+		Logger:             &noopLogger{},
+		Spool:              &SpoolConfig{Dir: t.TempDir(), RetryInterval: 20 * time.Millisecond},
+		OnTrackFailHandler: func(events []Event, err error) { failed.Add(1) },
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.TrackEvent(User{AnonID: "anon"}, "Spooled", nil))
+	require.NoError(t, c.Flush(context.Background()))
+	require.Zero(t, delivered.Load())
+
+	accept.Store(true)
+	require.Eventually(t, func() bool { return delivered.Load() == 1 }, 2*time.Second, 10*time.Millisecond)
+	require.Zero(t, failed.Load(), "spooled batches are not reported while they are retried")
+}
@@ -0,0 +1,134 @@
+package sensorswave
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of a client's tracking pipeline. Counters start at zero
+// when the client is created.
+type Stats struct {
+	EventsEnqueued uint64 // accepted into the event queue
+	EventsSent     uint64 // accepted by the track endpoint, or written to Config.Export
+	EventsFailed   uint64 // given up on, as reported to OnTrackFailHandler
+	EventsDropped  uint64 // discarded by the QueuePolicy, same as DroppedEvents
+	BatchesSent    uint64 // batches accepted by the track endpoint or Config.Export
+	RetryAttempts  uint64 // track requests that resent a batch or part of it
+	BytesSent      uint64 // JSON bytes of the sent batches, before compression
+
+	QueueDepth       int // events waiting in the queue
+	InFlightRequests int // track requests running or waiting for a concurrency slot
+
+	LastSuccess time.Time // zero until a batch was sent
+	LastFailure time.Time // zero until events failed
+	LastError   error     // error of the last failure
+
+	AB *ABStats // nil unless A/B testing is enabled
+}
+
+// ABStats describes the A/B metadata of a client.
+type ABStats struct {
+	LastLoad     time.Time // last successful meta load, zero if none
+	UpdateTime   int64     // UpdateTime of the current specs in ms, 0 if none are loaded
+	Specs        int       // number of loaded specs
+	LoadFailures uint64    // failed meta loads
+}
+
+// pipelineStats holds the tracking counters behind Client.Stats.
+type pipelineStats struct {
+	enqueued atomic.Uint64
+	sent     atomic.Uint64
+	failed   atomic.Uint64
+	batches  atomic.Uint64
+	retries  atomic.Uint64
+	bytes    atomic.Uint64
+
+	mu          sync.Mutex
+	lastSuccess time.Time
+	lastFailure time.Time
+	lastErr     error
+}
+
+// success records a batch of events that was sent.
+func (s *pipelineStats) success(events, bytes int) {
+	s.sent.Add(uint64(events))
+	s.batches.Add(1)
+	s.bytes.Add(uint64(bytes))
+	s.mu.Lock()
+	s.lastSuccess = time.Now()
+	s.mu.Unlock()
+}
+
+// failure records events that were given up on.
+func (s *pipelineStats) failure(events int, err error) {
+	s.failed.Add(uint64(events))
+	s.mu.Lock()
+	s.lastFailure, s.lastErr = time.Now(), err
+	s.mu.Unlock()
+}
+
+func (c *client) Stats() Stats {
+	st := Stats{
+		EventsEnqueued:   c.stats.enqueued.Load(),
+		EventsSent:       c.stats.sent.Load(),
+		EventsFailed:     c.stats.failed.Load(),
+		EventsDropped:    c.droppedEvents.Load(),
+		BatchesSent:      c.stats.batches.Load(),
+		RetryAttempts:    c.stats.retries.Load(),
+		BytesSent:        c.stats.bytes.Load(),
+		QueueDepth:       len(c.msgchan),
+		InFlightRequests: c.inflight.count(),
+	}
+	c.stats.mu.Lock()
+	st.LastSuccess, st.LastFailure, st.LastError = c.stats.lastSuccess, c.stats.lastFailure, c.stats.lastErr
+	c.stats.mu.Unlock()
+	if c.abCore != nil {
+		ab := c.abCore.Stats()
+		st.AB = &ab
+	}
+	return st
+}
+
+// Stats returns the state of the A/B metadata.
+func (abc *ABCore) Stats() ABStats {
+	st := ABStats{LoadFailures: abc.loadFailures.Load()}
+	if t := abc.lastLoad.Load(); t != 0 {
+		st.LastLoad = time.Unix(0, t)
+	}
+	if s := abc.storage(); s != nil {
+		st.UpdateTime = s.UpdateTime
+		st.Specs = len(s.ABSpecs)
+	}
+	return st
+}
+
+// countBatch returns the number of events in a JSON array batch without decoding it.
+func countBatch(jsonBody []byte) int {
+	n, depth, inString, escaped := 0, 0, false, false
+	for _, b := range jsonBody {
+		switch {
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case b == '\\':
+				escaped = true
+			case b == '"':
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '[' || b == '{':
+			if depth == 1 && n == 0 {
+				n = 1
+			}
+			depth++
+		case b == ']' || b == '}':
+			depth--
+		case b == ',' && depth == 1:
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,98 @@
+package sensorswave
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	var reject atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reject.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, err := NewWithConfig(Endpoint(server.URL), "token", Config{Logger: &noopLogger{}, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "Login", nil))
+	require.NoError(t, c.TrackBatch(ctx, []Event{NewEvent("", "u2", "Login"), NewEvent("", "u3", "Login")}))
+	require.NoError(t, c.Flush(ctx))
+
+	st := c.Stats()
+	require.Equal(t, uint64(3), st.EventsEnqueued)
+	require.Equal(t, uint64(3), st.EventsSent)
+	require.Equal(t, uint64(1), st.BatchesSent)
+	require.Positive(t, st.BytesSent)
+	require.False(t, st.LastSuccess.IsZero())
+	require.True(t, st.LastFailure.IsZero())
+	require.Zero(t, st.EventsFailed)
+	require.Zero(t, st.QueueDepth)
+	require.Zero(t, st.InFlightRequests)
+	require.Nil(t, st.AB)
+
+	reject.Store(true)
+	require.NoError(t, c.TrackEvent(User{LoginID: "u4"}, "Login", nil))
+	require.NoError(t, c.Flush(ctx))
+
+	st = c.Stats()
+	require.Equal(t, uint64(4), st.EventsEnqueued)
+	require.Equal(t, uint64(3), st.EventsSent)
+	require.Equal(t, uint64(1), st.EventsFailed)
+	require.False(t, st.LastFailure.IsZero())
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, st.LastError, &statusErr)
+	require.Equal(t, http.StatusBadRequest, statusErr.Code)
+}
+
+func TestCountBatch(t *testing.T) {
+	require.Equal(t, 0, countBatch([]byte(`[]`)))
+	require.Equal(t, 1, countBatch([]byte(`[{"a":[1,2]}]`)))
+	require.Equal(t, 3, countBatch([]byte(`[{"a":"x,}]\"{"},{"b":{"c":1,"d":2}},{}]`)))
+}
+
+type stubMetaLoader struct {
+	resp *ABDataResp
+	err  error
+}
+
+func (l *stubMetaLoader) LoadMeta() (*ABDataResp, error) {
+	return l.resp, l.err
+}
+
+func TestABStats(t *testing.T) {
+	loader := &stubMetaLoader{err: errors.New("unavailable")}
+	abc, err := NewABCore("", "token", &Config{Logger: &noopLogger{}, AB: &ABConfig{MetaLoader: loader}}, nil)
+	require.NoError(t, err)
+
+	abc.loadRemoteMeta()
+	st := abc.Stats()
+	require.Equal(t, uint64(1), st.LoadFailures)
+	require.True(t, st.LastLoad.IsZero())
+	require.Zero(t, st.Specs)
+
+	loader.resp, loader.err = &ABDataResp{
+		Update:     true,
+		UpdateTime: 1700000000000,
+		ABSpecs:    []ABSpec{{Key: "gate_a"}, {Key: "exp_b"}},
+	}, nil
+	abc.loadRemoteMeta()
+	st = abc.Stats()
+	require.Equal(t, uint64(1), st.LoadFailures)
+	require.False(t, st.LastLoad.IsZero())
+	require.Equal(t, int64(1700000000000), st.UpdateTime)
+	require.Equal(t, 2, st.Specs)
+}
@@ -0,0 +1,111 @@
+package sensorswave
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// PropertyProvider returns properties added to every tracked event, such as a
+// request-scoped tenant or the current deploy region. event is a copy; changes
+// to it are ignored. A provider that panics or exceeds Config.PropertyProviderTimeout
+// is skipped for that event, and for all events until the timed out call returns.
+type PropertyProvider func(ctx context.Context, event Event) Properties
+
+// property provider default
+const defaultPropertyProviderTimeout = 50 * time.Millisecond
+
+// RegisterSuperProperties adds properties sent with every event tracked by the client.
+// Later registrations overwrite earlier ones with the same key.
+// Invalid keys or values are rejected with a *ValidationError.
+func (c *client) RegisterSuperProperties(properties Properties) error {
+	opts := c.cfg.Validation
+	opts.Mode = ValidationStrict
+	props, err := validateProperties("super_properties", properties, &opts)
+	if err != nil {
+		return err
+	}
+
+	c.superMu.Lock()
+	defer c.superMu.Unlock()
+	merged := NewProperties().Merge(c.superProps).Merge(props) // copy on write, readers keep the old map
+	c.superProps = merged
+	return nil
+}
+
+// UnregisterSuperProperty removes a super property.
+func (c *client) UnregisterSuperProperty(key string) {
+	c.superMu.Lock()
+	defer c.superMu.Unlock()
+	if _, ok := c.superProps[key]; !ok {
+		return
+	}
+	props := NewProperties().Merge(c.superProps)
+	delete(props, key)
+	c.superProps = props
+}
+
+// enrich adds super properties and provider properties to event.
+// Properties set on the event win over providers, which win over super properties.
+// Profile events are left as they are.
+func (c *client) enrich(ctx context.Context, event *Event) {
+	if event.Event == PseUserSet || event.Event == PseGroupSet {
+		return
+	}
+	c.superMu.RLock()
+	super := c.superProps
+	c.superMu.RUnlock()
+	if len(super) == 0 && len(c.cfg.PropertyProviders) == 0 {
+		return
+	}
+
+	props := NewProperties().Merge(super)
+	for i, provider := range c.cfg.PropertyProviders {
+		props.Merge(c.provide(ctx, i, provider, *event))
+	}
+	event.Properties = props.Merge(event.Properties)
+}
+
+// provide runs one provider with panic recovery and a timeout.
+// A provider with a timed out call still running is skipped, so a hanging
+// provider holds at most the goroutines of the calls that timed out together.
+func (c *client) provide(ctx context.Context, i int, provider PropertyProvider, event Event) Properties {
+	stuck := &c.providerStuck[i]
+	if stuck.Load() > 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.PropertyProviderTimeout)
+	defer cancel()
+
+	// the provider may still run after the timeout, so it gets its own maps
+	event.Properties = NewProperties().Merge(event.Properties)
+	event.UserProperties = nil
+
+	done := make(chan Properties, 1)
+	var finished atomic.Bool // claimed by whichever of the call and the timeout comes first
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.cfg.Logger.Errorf("property provider %d panic: %v", i, r)
+				done <- nil
+			}
+			if !finished.CompareAndSwap(false, true) { // timed out before
+				stuck.Add(-1)
+			}
+		}()
+		done <- provider(ctx, event)
+	}()
+
+	select {
+	case props := <-done:
+		return props
+	case <-ctx.Done():
+		stuck.Add(1)
+		if !finished.CompareAndSwap(false, true) { // returned just now
+			stuck.Add(-1)
+			return <-done
+		}
+		c.cfg.Logger.Warnf("property provider %d skipped for event %s: %v", i, event.Event, ctx.Err())
+		return nil
+	}
+}
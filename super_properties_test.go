@@ -0,0 +1,100 @@
+package sensorswave
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSuperPropsTestClient(providers ...PropertyProvider) *client {
+	c := newImpressTestClient()
+	c.cfg.PropertyProviders = providers
+	c.cfg.PropertyProviderTimeout = 20 * time.Millisecond
+	c.providerStuck = make([]atomic.Int32, len(providers))
+	return c
+}
+
+func TestSuperPropertiesPrecedence(t *testing.T) {
+	c := newSuperPropsTestClient(func(ctx context.Context, event Event) Properties {
+		return Properties{"region": "eu", "tenant": "t1"}
+	})
+	require.NoError(t, c.RegisterSuperProperties(Properties{"service": "api", "region": "us", PspAppVer: "1.2"}))
+
+	user := User{LoginID: "u1"}
+	require.NoError(t, c.TrackEvent(user, "Login", Properties{"tenant": "t2"}))
+	evt := readImpressEvent(t, c)
+	require.Equal(t, "api", evt.Properties["service"])
+	require.Equal(t, "1.2", evt.Properties[PspAppVer])
+	require.Equal(t, "eu", evt.Properties["region"], "providers win over super properties")
+	require.Equal(t, "t2", evt.Properties["tenant"], "event properties win over providers")
+
+	c.UnregisterSuperProperty("service")
+	require.NoError(t, c.ProfileSet(user, Properties{"name": "n"}))
+	evt = readImpressEvent(t, c)
+	require.NotContains(t, evt.Properties, "region", "profile events are not enriched")
+
+	require.NoError(t, c.TrackEvent(user, "Logout", nil))
+	evt = readImpressEvent(t, c)
+	require.NotContains(t, evt.Properties, "service")
+}
+
+func TestRegisterSuperPropertiesRejectsInvalid(t *testing.T) {
+	c := newSuperPropsTestClient()
+	var verr *ValidationError
+	require.ErrorAs(t, c.RegisterSuperProperties(Properties{"$secret": 1}), &verr)
+	require.ErrorIs(t, verr, ErrPropertyKeyReserved)
+	require.Empty(t, c.superProps)
+}
+
+func TestPropertyProviderContained(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	c := newSuperPropsTestClient(
+		func(ctx context.Context, event Event) Properties { panic("boom") },
+		func(ctx context.Context, event Event) Properties {
+			<-release
+			return Properties{"slow": true}
+		},
+		func(ctx context.Context, event Event) Properties {
+			event.Properties["mutated"] = true // providers get a copy
+			return Properties{"ok": true}
+		},
+	)
+
+	start := time.Now()
+	require.NoError(t, c.TrackEvent(User{LoginID: "u1"}, "Login", Properties{"a": 1}))
+	require.Less(t, time.Since(start), time.Second)
+
+	evt := readImpressEvent(t, c)
+	require.Equal(t, true, evt.Properties["ok"])
+	require.NotContains(t, evt.Properties, "slow")
+	require.NotContains(t, evt.Properties, "mutated")
+}
+
+func TestPropertyProviderSkippedWhileStuck(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	c := newSuperPropsTestClient(func(ctx context.Context, event Event) Properties {
+		if calls.Add(1) == 1 {
+			<-release
+		}
+		return Properties{"region": "eu"}
+	})
+	user := User{LoginID: "u1"}
+
+	require.NoError(t, c.TrackEvent(user, "First", nil))
+	require.NotContains(t, readImpressEvent(t, c).Properties, "region")
+
+	// The timed out call still runs, the provider is not called again
+	require.NoError(t, c.TrackEvent(user, "Second", nil))
+	require.NotContains(t, readImpressEvent(t, c).Properties, "region")
+	require.Equal(t, int32(1), calls.Load())
+
+	close(release)
+	require.Eventually(t, func() bool { return c.providerStuck[0].Load() == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, c.TrackEvent(user, "Third", nil))
+	require.Equal(t, "eu", readImpressEvent(t, c).Properties["region"])
+}
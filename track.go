@@ -4,34 +4,72 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
+// httpResponseTrack defines the API response structure of the track endpoint.
+type httpResponseTrack struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    trackResponseData `json:"data"`
+}
+
+// trackResponseData lists the events of a batch the server did not ingest.
+type trackResponseData struct {
+	Rejected []TrackRejection `json:"rejected,omitempty"`
+}
+
+// TrackRejection is a single event the server refused to ingest.
+type TrackRejection struct {
+	TraceID   string `json:"trace_id"`
+	Reason    string `json:"reason"`
+	Retryable bool   `json:"retryable"`
+}
+
 // ////////////////////////////////// client inner funcs
 
 type messageQueue struct {
 	pending  [][]byte
 	size     int // length of pending
 	bodySize int
+	maxSize  int // max events in a batch
 }
 
-func (q *messageQueue) push(msg []byte) (jsonBody []byte) {
+// push appends msg and returns the batches that became ready. A pending
+// batch is flushed before msg is appended if msg would push it over maxHTTPBodySize.
+func (q *messageQueue) push(msg []byte) (jsonBodies [][]byte) {
+	if q.maxSize <= 0 {
+		q.maxSize = defaultBatchSize
+	}
+	if q.size > 0 && q.bodyLen()+len(msg)+1 > maxHTTPBodySize {
+		jsonBodies = append(jsonBodies, q.flush())
+	}
 	if q.pending == nil { // re init
-		q.pending = make([][]byte, 0, maxBatchSize)
+		q.pending = make([][]byte, 0, q.maxSize)
 		q.size = 0
 		q.bodySize = 0
 	}
 	q.pending = append(q.pending, msg)
 	q.size++
 	q.bodySize += len(msg)
-	if q.size >= maxBatchSize || q.bodySize >= maxHTTPBodySize {
-		jsonBody = q.flush()
+	if q.size >= q.maxSize || q.bodyLen() >= maxHTTPBodySize {
+		jsonBodies = append(jsonBodies, q.flush())
 	}
 	return
 }
 
+// bodyLen is the length of the JSON array the pending messages encode to.
+func (q *messageQueue) bodyLen() int {
+	if q.size == 0 {
+		return 0
+	}
+	return q.bodySize + q.size - 1 + 2 // commas and brackets
+}
+
 func (q *messageQueue) flush() (jsonBody []byte) {
 	if q.size == 0 {
 		return
@@ -47,6 +85,8 @@ func (q *messageQueue) flush() (jsonBody []byte) {
 	}
 	buf.WriteByte(']')
 	q.pending = nil
+	q.size = 0
+	q.bodySize = 0
 	jsonBody = buf.Bytes()
 	return
 }
@@ -57,13 +97,28 @@ func (c *client) loop() {
 	tick := time.NewTicker(c.cfg.FlushInterval)
 	defer tick.Stop()
 
-	msgQue := messageQueue{}
+	msgQue := messageQueue{maxSize: c.cfg.MaxBatchSize}
 	for {
 		select {
 		case msg := <-c.msgchan:
 			_ = c.push(&msgQue, msg)
 		case <-tick.C:
 			_ = c.flush(&msgQue)
+		case msgs := <-c.bulkchan:
+			// keep the order of events queued before the batch
+			for n := len(c.msgchan); n > 0; n-- {
+				_ = c.push(&msgQue, <-c.msgchan)
+			}
+			for _, msg := range msgs {
+				_ = c.push(&msgQue, msg)
+			}
+		case done := <-c.flushReq:
+			// take the events queued before the flush request
+			for n := len(c.msgchan); n > 0; n-- {
+				_ = c.push(&msgQue, <-c.msgchan)
+			}
+			_ = c.flush(&msgQue)
+			close(done)
 		case <-c.quit:
 			c.cfg.Logger.Debugf("loop closing: draining messages")
 			close(c.msgchan)
@@ -77,8 +132,97 @@ func (c *client) loop() {
 	}
 }
 
+// enqueue hands a message to the loop according to the configured QueuePolicy.
+// Waiting for room is abandoned when ctx is done.
+func (c *client) enqueue(ctx context.Context, msg []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrClosed
+		}
+	}()
+	if c.pool != nil {
+		defer c.pool.wake(c)
+	}
+
+	switch c.cfg.QueuePolicy {
+	case QueueBlockTimeout:
+		select {
+		case c.msgchan <- msg:
+			c.stats.enqueued.Add(1)
+			return nil
+		default:
+		}
+		timer := time.NewTimer(c.cfg.EnqueueTimeout)
+		defer timer.Stop()
+		select {
+		case c.msgchan <- msg:
+			c.stats.enqueued.Add(1)
+			return nil
+		case <-timer.C:
+			c.dropped(1)
+			return ErrTooManyRequests
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	case QueueDropNewest:
+		select {
+		case c.msgchan <- msg:
+			c.stats.enqueued.Add(1)
+			return nil
+		default:
+			c.dropped(1)
+			return ErrTooManyRequests
+		}
+	case QueueDropOldest:
+		for {
+			select {
+			case c.msgchan <- msg:
+				c.stats.enqueued.Add(1)
+				return nil
+			default:
+			}
+			// Evict one queued event; the loop may have drained it already.
+			select {
+			case <-c.msgchan:
+				c.dropped(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case c.msgchan <- msg:
+			c.stats.enqueued.Add(1)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// dropped counts events discarded by the queue policy.
+func (c *client) dropped(n uint64) {
+	total := c.droppedEvents.Add(n)
+	if total > n && total/1000 == (total-n)/1000 { // log the first drop and then every 1000
+		return
+	}
+	c.cfg.Logger.Warnf("event queue full, dropped %d events (total %d, policy %s)", n, total, c.cfg.QueuePolicy)
+}
+
 func (c *client) push(msgq *messageQueue, msg []byte) (err error) {
-	if jsonBody := msgq.push(msg); jsonBody != nil {
+	for _, w := range c.sinks {
+		w.offer(msg)
+	}
+	if c.export != nil { // batched and written by the export worker
+		// Waiting here fills msgchan, so a stalled export applies the QueuePolicy to Track.
+		if !c.export.put(c.ctx, msg) {
+			c.reportFailed(joinBatch([]json.RawMessage{msg}), c.ctx.Err())
+		}
+		return
+	}
+	if c.endpoint == "" { // sinks only
+		return
+	}
+	for _, jsonBody := range msgq.push(msg) {
 		c.send(jsonBody)
 	}
 	return
@@ -95,46 +239,439 @@ func (c *client) send(jsonBody []byte) {
 	if len(jsonBody) <= 2 {
 		return
 	}
-	// Control concurrency
-	<-c.sem
+	var (
+		id      spoolID
+		spooled bool
+	)
+	if c.spool != nil {
+		var err error
+		if id, err = c.spool.append(jsonBody); err != nil {
+			c.cfg.Logger.Errorf("spool append error: %v", err)
+		} else {
+			spooled = true
+		}
+	}
+	c.dispatch(jsonBody, id, spooled)
+}
+
+// exported counts a batch written by the export worker as sent.
+func (c *client) exported(events []json.RawMessage) {
+	size := 1 // the JSON array the batch would be sent as
+	for _, event := range events {
+		size += len(event) + 1
+	}
+	c.stats.success(len(events), size)
+}
+
+// exportRetryPolicy retries failed export writes until the client closes,
+// backing off like DefaultRetryPolicy. Batches still failing then are reported
+// to OnDeliveryResult.
+type exportRetryPolicy struct {
+	quit   <-chan struct{}
+	logger Logger
+}
+
+func (p exportRetryPolicy) NextRetry(a RetryAttempt) (time.Duration, bool) {
+	select {
+	case <-p.quit:
+		return 0, false
+	default:
+	}
+	if a.Attempt == 1 || a.Attempt%100 == 0 {
+		p.logger.Errorf("export write failed %d times, retrying until the client closes: %v", a.Attempt, a.Err)
+	}
+	return DefaultRetryPolicy{}.backoff(a.Attempt), true
+}
+
+// replaySpool resends the batches left in the spool by a previous run, then
+// resends the batches that failed with a retryable error every RetryInterval.
+// Batches not dispatched before Close stay in the spool for the next run.
+func (c *client) replaySpool() {
+	defer c.wg.Done()
+
+	if batches := c.spool.takeReplay(); len(batches) > 0 {
+		c.cfg.Logger.Infof("spool replaying %d batches", len(batches))
+		if !c.redispatch(batches) {
+			return
+		}
+	}
+
+	tick := time.NewTicker(c.spool.cfg.RetryInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if batches := c.spool.takeFailed(); len(batches) > 0 {
+				c.cfg.Logger.Infof("spool retrying %d failed batches", len(batches))
+				if !c.redispatch(batches) {
+					return
+				}
+			}
+		case <-c.quit:
+			return
+		}
+	}
+}
+
+// redispatch dispatches spooled batches and reports false once the client is closing.
+func (c *client) redispatch(batches []spoolBatch) bool {
+	for _, b := range batches {
+		select {
+		case <-c.quit:
+			return false
+		default:
+		}
+		c.dispatch(b.body, b.id, true)
+	}
+	return true
+}
+
+// inflightTracker counts the track requests of one client so Flush can wait
+// for them without waiting for the other clients of a Pool.
+type inflightTracker struct {
+	mu   sync.Mutex
+	n    int
+	idle chan struct{} // closed once n drops to 0, nil before the first request
+}
+
+func (t *inflightTracker) add() {
+	t.mu.Lock()
+	if t.n == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.n++
+	t.mu.Unlock()
+}
+
+func (t *inflightTracker) done() {
+	t.mu.Lock()
+	t.n--
+	if t.n == 0 {
+		close(t.idle)
+	}
+	t.mu.Unlock()
+}
+
+func (t *inflightTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.n
+}
+
+// wait returns once no request is running.
+func (t *inflightTracker) wait(ctx context.Context) error {
+	t.mu.Lock()
+	idle := t.idle
+	t.mu.Unlock()
+	if idle == nil {
+		return nil
+	}
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dispatch sends a batch in the background, bounded by HTTPConcurrency.
+// A client of a Pool takes the shared concurrency slot in the background,
+// so the pool worker never waits for the requests of other projects.
+func (c *client) dispatch(jsonBody []byte, id spoolID, spooled bool) {
 	c.wg.Add(1)
+	c.inflight.add()
+	// Control concurrency
+	acquired := c.pool == nil
+	if acquired {
+		<-c.sem
+	}
 	go func(jsonBody []byte) {
 		defer func() {
-			c.sem <- struct{}{}
+			c.inflight.done()
 			c.wg.Done()
 		}()
+		if !acquired {
+			select {
+			case <-c.sem:
+			case <-c.ctx.Done(): // close gave up; a spooled batch stays for the next run
+				if !spooled {
+					c.reportFailed(jsonBody, c.ctx.Err())
+				}
+				return
+			}
+		}
+		defer func() { c.sem <- struct{}{} }()
 
-		headers := map[string]string{
-			"Content-Type":    "application/json",
-			"User-Agent":      "", // Disable default Go User-Agent; SDK info is sent via other headers
-			HeaderSourceToken: c.sourceToken,
-		}
-
-		trackURL := strings.TrimRight(c.endpoint, "/") + c.cfg.TrackURIPath
-		opts := newRequestOpts().
-			WithMethod("POST").
-			WithURL(trackURL).
-			WithHeaders(headers).
-			WithBody(jsonBody).
-			WithTimeout(c.cfg.HTTPTimeout).
-			WithRetry(c.cfg.HTTPRetry)
-		_, httpcode, err := c.h.Do(context.Background(), opts)
-		if err != nil || httpcode != http.StatusOK {
+		done := c.deliver(c.ctx, jsonBody, spooled)
+		if !spooled {
+			return
+		}
+		if !done {
+			c.spool.fail(id)
+			return
+		}
+		if err := c.spool.ack(id); err != nil {
+			c.cfg.Logger.Errorf("spool ack error: %v", err)
+		}
+	}(jsonBody)
+}
+
+// deliver posts a batch to the track endpoint and reports whether it is done:
+// accepted, or failed for good and reported to the failure callback. A spooled
+// batch that failed with a retryable error is not done; the spool resends it.
+// Events the server rejected as retryable are resent up to HTTPRetry times;
+// the others are reported to the failure callback with the server's reason.
+func (c *client) deliver(ctx context.Context, jsonBody []byte, spooled bool) (done bool) {
+	for round := 0; ; round++ {
+		start := time.Now()
+		respBody, httpcode, attempts, err := c.post(ctx, jsonBody)
+		retries := max(attempts-1, 0)
+		if round > 0 { // resending retryable rejections
+			retries++
+		}
+		c.stats.retries.Add(uint64(retries))
+		result := DeliveryResult{
+			HTTPCode:   httpcode,
+			Attempts:   attempts,
+			BatchBytes: len(jsonBody),
+		}
+		if err == nil && httpcode == http.StatusRequestEntityTooLarge {
+			result.Err = &HTTPStatusError{Code: httpcode}
+			c.reportDelivery(&result, jsonBody, start)
+			return c.deliverSplit(ctx, jsonBody)
+		}
+		retryable := isRetryable(httpcode, err)
+		if err == nil && httpcode != http.StatusOK {
+			err = &HTTPStatusError{Code: httpcode}
+		}
+		if err != nil {
 			c.cfg.Logger.Errorf("http send event error: %v httpcode:%d", err, httpcode)
-			if c.cfg.OnTrackFailHandler != nil {
-				var events []Event
-				if err := json.Unmarshal(jsonBody, &events); err != nil {
-					c.cfg.Logger.Errorf("unmarshal fail events error: %v", err)
-				}
-				c.cfg.OnTrackFailHandler(events, err)
+			if spooled && retryable && round == 0 { // a resend of rejected events can't be spooled separately
+				result.Err = err
+				c.reportDelivery(&result, jsonBody, start)
+				return false
 			}
+			c.reportFailed(jsonBody, err)
 			if len(jsonBody) > 100 {
 				c.cfg.Logger.Debugf("http send body body  : (%s)", string(jsonBody[:100]))
 			} else {
 				c.cfg.Logger.Debugf("http send body body  : (%s)", string(jsonBody))
 			}
-		} else {
-			c.cfg.Logger.Debugf("http send body length: %d ", len(jsonBody))
+			result.Err = err
+			c.reportDelivery(&result, jsonBody, start)
+			return true
 		}
-	}(jsonBody)
+		c.cfg.Logger.Debugf("http send body length: %d ", len(jsonBody))
+
+		resp, err := parseTrackResponse(respBody)
+		if err != nil { // e.g. an error page from a proxy; the events may not have arrived
+			c.cfg.Logger.Errorf("track response: %v, body: %.100s", err, respBody)
+			result.Err = err
+			c.reportDelivery(&result, jsonBody, start)
+			if spooled && round == 0 {
+				return false
+			}
+			c.reportFailed(jsonBody, err)
+			return true
+		}
+		if resp.Code != 0 {
+			c.cfg.Logger.Errorf("track batch rejected: code:%d message:%s", resp.Code, resp.Message)
+			result.Err = &RejectedError{Code: resp.Code, Reason: resp.Message}
+			c.reportFailed(jsonBody, result.Err)
+			c.reportDelivery(&result, jsonBody, start)
+			return true
+		}
+		result.Success = true
+		result.Rejected = resp.Data.Rejected
+		c.stats.success(countBatch(jsonBody)-len(resp.Data.Rejected), len(jsonBody))
+		c.reportDelivery(&result, jsonBody, start)
+		if len(resp.Data.Rejected) == 0 {
+			return true
+		}
+
+		retryBody := c.handleRejections(jsonBody, resp.Data.Rejected, round < c.cfg.HTTPRetry)
+		if retryBody == nil {
+			return true
+		}
+		if !sleepContext(ctx, defaultRetryBaseDelay<<round) {
+			c.reportFailed(retryBody, ctx.Err())
+			return true
+		}
+		jsonBody = retryBody
+	}
+}
+
+// deliverSplit resends a batch the server found too large as two halves.
+// A single event that is still too large is reported with ErrMessageTooBig.
+// The halves are not spooled, so their failures are reported and the batch is done.
+func (c *client) deliverSplit(ctx context.Context, jsonBody []byte) (done bool) {
+	msgs, _, err := splitBatch(jsonBody)
+	if err != nil {
+		c.cfg.Logger.Errorf("split oversized batch error: %v", err)
+		c.reportFailed(jsonBody, ErrMessageTooBig)
+		return true
+	}
+	if len(msgs) <= 1 {
+		c.cfg.Logger.Errorf("http send event error: %v, size:%d", ErrMessageTooBig, len(jsonBody))
+		c.reportFailed(jsonBody, ErrMessageTooBig)
+		return true
+	}
+
+	half := len(msgs) / 2
+	c.cfg.Logger.Warnf("batch of %d events too large, splitting", len(msgs))
+	c.deliver(ctx, joinBatch(msgs[:half]), false)
+	c.deliver(ctx, joinBatch(msgs[half:]), false)
+	return true
+}
+
+// post sends one batch with the configured compression and retry policy.
+func (c *client) post(ctx context.Context, jsonBody []byte) (respBody []byte, httpcode int, attempts int, err error) {
+	headers := map[string]string{
+		"Content-Type":    "application/json",
+		HeaderSourceToken: c.sourceToken,
+	}
+
+	body, encoding, err := compressBody(c.cfg.Compression, jsonBody, c.cfg.CompressionMinBytes)
+	if err != nil {
+		c.cfg.Logger.Warnf("%s compress error, sending uncompressed: %v", c.cfg.Compression, err)
+	}
+	if encoding != "" {
+		headers["Content-Encoding"] = encoding
+	}
+
+	trackURL := strings.TrimRight(c.endpoint, "/") + c.cfg.TrackURIPath
+	opts := newRequestOpts().
+		WithMethod("POST").
+		WithURL(trackURL).
+		WithHeaders(headers).
+		WithBody(body).
+		WithTimeout(c.cfg.HTTPTimeout).
+		WithRetry(c.cfg.HTTPRetry).
+		WithRetryPolicy(c.cfg.RetryPolicy)
+	if c.cfg.SignTrackRequests {
+		opts.WithSigner(c.signTrack)
+	}
+	opts.Headers["User-Agent"] = "" // Disable default Go User-Agent; SDK info is sent via other headers
+	return c.h.doAttempts(ctx, opts)
+}
+
+// signTrack signs one track request attempt over the (possibly compressed) body.
+// The empty User-Agent is left out of the signature since it is never sent.
+func (c *client) signTrack(headers map[string]string, body []byte) {
+	delete(headers, "User-Agent")
+	SignRequest("POST", c.cfg.TrackURIPath, "", headers, body, c.sourceToken, c.cfg.ProjectSecret)
+	headers["User-Agent"] = ""
+}
+
+// handleRejections reports the events the server refused for good and returns
+// a batch of the retryable ones, or nil if nothing should be resent.
+func (c *client) handleRejections(jsonBody []byte, rejected []TrackRejection, canRetry bool) (retryBody []byte) {
+	msgs, traceIDs, err := splitBatch(jsonBody)
+	if err != nil {
+		c.cfg.Logger.Errorf("split rejected batch error: %v", err)
+		return nil
+	}
+	byTraceID := make(map[string]json.RawMessage, len(msgs))
+	for i, id := range traceIDs {
+		byTraceID[id] = msgs[i]
+	}
+
+	var (
+		retry   []json.RawMessage
+		reasons []string
+		failed  = make(map[string][]json.RawMessage)
+	)
+	for _, r := range rejected {
+		msg, ok := byTraceID[r.TraceID]
+		if !ok {
+			c.cfg.Logger.Warnf("track rejection for unknown trace_id %s: %s", r.TraceID, r.Reason)
+			continue
+		}
+		delete(byTraceID, r.TraceID)
+		if r.Retryable && canRetry {
+			retry = append(retry, msg)
+			continue
+		}
+		if _, ok := failed[r.Reason]; !ok {
+			reasons = append(reasons, r.Reason)
+		}
+		failed[r.Reason] = append(failed[r.Reason], msg)
+	}
+
+	for _, reason := range reasons {
+		c.cfg.Logger.Errorf("track rejected %d events: %s", len(failed[reason]), reason)
+		c.reportFailed(joinBatch(failed[reason]), &RejectedError{Reason: reason})
+	}
+	if len(retry) == 0 {
+		return nil
+	}
+	return joinBatch(retry)
+}
+
+// reportDelivery completes a result and hands it to OnDeliveryResult.
+func (c *client) reportDelivery(result *DeliveryResult, jsonBody []byte, start time.Time) {
+	if c.cfg.OnDeliveryResult == nil {
+		return
+	}
+	result.Latency = time.Since(start)
+	if err := json.Unmarshal(jsonBody, &result.Events); err != nil {
+		c.cfg.Logger.Errorf("unmarshal delivered events error: %v", err)
+	}
+	c.cfg.OnDeliveryResult(*result)
+}
+
+// reportFailed counts the events of a failed batch and hands them to the failure callback.
+func (c *client) reportFailed(jsonBody []byte, err error) {
+	c.stats.failure(countBatch(jsonBody), err)
+	if c.onFailed != nil {
+		c.onFailed(jsonBody, err)
+	}
+	if c.cfg.OnTrackFailHandler == nil {
+		return
+	}
+	var events []Event
+	if err := json.Unmarshal(jsonBody, &events); err != nil {
+		c.cfg.Logger.Errorf("unmarshal fail events error: %v", err)
+	}
+	c.cfg.OnTrackFailHandler(events, err)
+}
+
+// parseTrackResponse decodes the track response envelope. An empty body is a plain success.
+func parseTrackResponse(respBody []byte) (resp httpResponseTrack, err error) {
+	if len(bytes.TrimSpace(respBody)) == 0 {
+		return resp, nil
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return resp, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return resp, nil
+}
+
+// splitBatch splits a JSON array batch into its events and their trace IDs.
+func splitBatch(jsonBody []byte) (msgs []json.RawMessage, traceIDs []string, err error) {
+	if err = json.Unmarshal(jsonBody, &msgs); err != nil {
+		return nil, nil, err
+	}
+	traceIDs = make([]string, len(msgs))
+	for i, msg := range msgs {
+		var ev struct {
+			TraceID string `json:"trace_id"`
+		}
+		if err = json.Unmarshal(msg, &ev); err != nil {
+			return nil, nil, err
+		}
+		traceIDs[i] = ev.TraceID
+	}
+	return msgs, traceIDs, nil
+}
+
+// joinBatch builds a JSON array batch from encoded events.
+func joinBatch(msgs []json.RawMessage) []byte {
+	q := messageQueue{maxSize: len(msgs) + 1}
+	for _, msg := range msgs {
+		q.pending = append(q.pending, msg)
+		q.size++
+		q.bodySize += len(msg)
+	}
+	return q.flush()
 }
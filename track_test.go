@@ -1,8 +1,17 @@
 package sensorswave
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestIdentifyEventName(t *testing.T) {
@@ -158,3 +167,290 @@ func TestEventJSONSerialization(t *testing.T) {
 		t.Errorf("expected $lib_version in decoded event to be '%s', got '%v'", version, decoded.Properties[PspLibVersion])
 	}
 }
+
+func newQueueTestClient(policy QueuePolicy) *client {
+	return &client{
+		cfg:     &Config{Logger: &noopLogger{}, QueuePolicy: policy, EnqueueTimeout: 10 * time.Millisecond},
+		msgchan: make(chan []byte, 2),
+	}
+}
+
+func TestQueuePolicyDropNewest(t *testing.T) {
+	c := newQueueTestClient(QueueDropNewest)
+	require.NoError(t, c.enqueue(context.Background(), []byte("1")))
+	require.NoError(t, c.enqueue(context.Background(), []byte("2")))
+	require.ErrorIs(t, c.enqueue(context.Background(), []byte("3")), ErrTooManyRequests)
+	require.Equal(t, uint64(1), c.DroppedEvents())
+	require.Equal(t, "1", string(<-c.msgchan))
+	require.Equal(t, "2", string(<-c.msgchan))
+}
+
+func TestQueuePolicyDropOldest(t *testing.T) {
+	c := newQueueTestClient(QueueDropOldest)
+	require.NoError(t, c.enqueue(context.Background(), []byte("1")))
+	require.NoError(t, c.enqueue(context.Background(), []byte("2")))
+	require.NoError(t, c.enqueue(context.Background(), []byte("3")), "the new event is queued")
+	require.Equal(t, uint64(1), c.DroppedEvents())
+	require.Equal(t, "2", string(<-c.msgchan))
+	require.Equal(t, "3", string(<-c.msgchan))
+}
+
+func TestQueuePolicyBlockTimeout(t *testing.T) {
+	c := newQueueTestClient(QueueBlockTimeout)
+	require.NoError(t, c.enqueue(context.Background(), []byte("1")))
+	require.NoError(t, c.enqueue(context.Background(), []byte("2")))
+	require.ErrorIs(t, c.enqueue(context.Background(), []byte("3")), ErrTooManyRequests)
+	require.Equal(t, uint64(1), c.DroppedEvents())
+}
+
+func TestEnqueueAfterCloseReturnsErrClosed(t *testing.T) {
+	c, err := NewWithConfig(Endpoint("http://test.example.com"), SourceToken("test-token"), Config{Logger: &noopLogger{}})
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+	require.ErrorIs(t, c.TrackEvent(User{AnonID: "anon"}, "AfterClose", nil), ErrClosed)
+}
+
+func TestMessageQueueBatchSize(t *testing.T) {
+	q := messageQueue{maxSize: 2}
+	require.Empty(t, q.push([]byte(`{"a":1}`)))
+	bodies := q.push([]byte(`{"b":2}`))
+	require.Len(t, bodies, 1)
+	require.Equal(t, `[{"a":1},{"b":2}]`, string(bodies[0]))
+	require.Nil(t, q.flush())
+}
+
+func TestFlushDeliversQueuedEvents(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []Event
+		_ = json.NewDecoder(r.Body).Decode(&events)
+		received.Add(int32(len(events)))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), Config{Logger: &noopLogger{}, FlushInterval: time.Hour})
+	require.NoError(t, err)
+	defer c.Close()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, c.TrackEventContext(context.Background(), User{AnonID: "anon"}, "Flushed", nil))
+	}
+	require.NoError(t, c.Flush(context.Background()))
+	require.Equal(t, int32(3), received.Load())
+}
+
+func TestCloseContextAbortsInflightRequests(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), Config{Logger: &noopLogger{}, HTTPTimeout: time.Minute})
+	require.NoError(t, err)
+	require.NoError(t, c.Track(NewEvent("anon", "", "Stuck")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.ErrorIs(t, c.CloseContext(ctx), context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestTrackContextCancelled(t *testing.T) {
+	c := newQueueTestClient(QueueBlock)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, c.TrackContext(ctx, NewEvent("anon", "", "Cancelled")), context.Canceled)
+}
+
+func TestTrackResponseRejections(t *testing.T) {
+	var requests atomic.Int32
+	batches := make(chan []Event, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []Event
+		_ = json.NewDecoder(r.Body).Decode(&events)
+		batches <- events
+		if requests.Add(1) > 1 {
+			_, _ = w.Write([]byte(`{"code":0,"message":"ok"}`))
+			return
+		}
+		resp := httpResponseTrack{Data: trackResponseData{Rejected: []TrackRejection{
+			{TraceID: "trace-bad", Reason: "invalid property"},
+			{TraceID: "trace-busy", Reason: "shard busy", Retryable: true},
+		}}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	type failure struct {
+		events []Event
+		err    error
+	}
+	failures := make(chan failure, 4)
+	cfg := Config{
+		Logger: &noopLogger{},
+		OnTrackFailHandler: func(events []Event, err error) {
+			failures <- failure{events: events, err: err}
+		},
+	}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+
+	for _, id := range []string{"trace-ok", "trace-bad", "trace-busy"} {
+		require.NoError(t, c.Track(NewEvent("anon", "", "Checked").WithTraceID(id)))
+	}
+	require.NoError(t, c.Close())
+
+	require.Len(t, <-batches, 3)
+	resent := <-batches
+	require.Len(t, resent, 1)
+	require.Equal(t, "trace-busy", resent[0].TraceID)
+
+	f := <-failures
+	require.Len(t, f.events, 1)
+	require.Equal(t, "trace-bad", f.events[0].TraceID)
+	require.ErrorIs(t, f.err, ErrEventRejected)
+	var rejected *RejectedError
+	require.ErrorAs(t, f.err, &rejected)
+	require.Equal(t, "invalid property", rejected.Reason)
+	require.Empty(t, failures)
+}
+
+func TestParseTrackResponse(t *testing.T) {
+	resp, err := parseTrackResponse(nil)
+	require.NoError(t, err)
+	require.Zero(t, resp.Code)
+
+	_, err = parseTrackResponse([]byte("<html>"))
+	require.ErrorIs(t, err, ErrInvalidResponse)
+
+	resp, err = parseTrackResponse([]byte(`{"code":4001,"message":"token disabled"}`))
+	require.NoError(t, err)
+	require.Equal(t, 4001, resp.Code)
+	require.Equal(t, "token disabled", resp.Message)
+}
+
+func TestOnDeliveryResult(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	results := make(chan DeliveryResult, 4)
+	failErrs := make(chan error, 4)
+	cfg := Config{
+		Logger:           &noopLogger{},
+		FlushInterval:    time.Hour,
+		RetryPolicy:      DefaultRetryPolicy{MaxRetries: 2, BaseDelay: time.Millisecond},
+		OnDeliveryResult: func(r DeliveryResult) { results <- r },
+		OnTrackFailHandler: func(events []Event, err error) {
+			failErrs <- err
+		},
+	}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Track(NewEvent("anon", "", "Delivered")))
+	require.NoError(t, c.Flush(context.Background()))
+	r := <-results
+	require.True(t, r.Success)
+	require.Equal(t, http.StatusOK, r.HTTPCode)
+	require.Equal(t, 1, r.Attempts)
+	require.NoError(t, r.Err)
+	require.Len(t, r.Events, 1)
+	require.Equal(t, "Delivered", r.Events[0].Event)
+	require.Positive(t, r.BatchBytes)
+
+	status.Store(http.StatusServiceUnavailable)
+	require.NoError(t, c.Track(NewEvent("anon", "", "Unavailable")))
+	require.NoError(t, c.Flush(context.Background()))
+	r = <-results
+	require.False(t, r.Success)
+	require.Equal(t, http.StatusServiceUnavailable, r.HTTPCode)
+	require.Equal(t, 3, r.Attempts)
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, r.Err, &statusErr)
+	require.Equal(t, http.StatusServiceUnavailable, statusErr.Code)
+	require.ErrorAs(t, <-failErrs, &statusErr)
+}
+
+func TestTrackRejectsOversizedEvent(t *testing.T) {
+	c := newQueueTestClient(QueueBlock)
+	event := NewEvent("anon", "", "Big").WithProperties(Properties{"blob": strings.Repeat("x", maxHTTPBodySize)})
+	require.ErrorIs(t, c.Track(event), ErrMessageTooBig)
+	require.Empty(t, c.msgchan)
+}
+
+func TestMessageQueueFlushesBeforeOverflow(t *testing.T) {
+	q := messageQueue{maxSize: 10}
+	big := []byte(`"` + strings.Repeat("x", maxHTTPBodySize/2) + `"`)
+	require.Empty(t, q.push(big))
+	bodies := q.push(big)
+	require.Len(t, bodies, 1)
+	require.LessOrEqual(t, len(bodies[0]), maxHTTPBodySize)
+	require.Equal(t, 1, q.size)
+}
+
+func TestDeliverSplitsOn413(t *testing.T) {
+	var mu sync.Mutex
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+			events = nil // recorded as an empty batch
+		}
+		mu.Lock()
+		batches = append(batches, len(events))
+		mu.Unlock()
+		if len(events) > 1 {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	cfg := Config{Logger: &noopLogger{}, FlushInterval: time.Hour}
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), cfg)
+	require.NoError(t, err)
+	defer c.Close()
+
+	for _, name := range []string{"A", "B", "C"} {
+		require.NoError(t, c.Track(NewEvent("anon", "", name)))
+	}
+	require.NoError(t, c.Flush(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []int{3, 1, 2, 1, 1}, batches)
+}
+
+func TestUnparseableResponseIsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("<html>maintenance</html>"))
+	}))
+	defer server.Close()
+
+	var failErr atomic.Value
+	c, err := NewWithConfig(Endpoint(server.URL), SourceToken("test-token"), Config{
+		Logger:             &noopLogger{},
+		OnTrackFailHandler: func(events []Event, err error) { failErr.Store(err) },
+	})
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, c.Track(NewEvent("anon", "", "A")))
+	require.NoError(t, c.Flush(context.Background()))
+	require.ErrorIs(t, failErr.Load().(error), ErrInvalidResponse)
+	require.Zero(t, c.Stats().EventsSent)
+}
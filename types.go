@@ -85,16 +85,73 @@ func (e *Event) Bytes() []byte {
 	return b
 }
 
+// Normalize fills in defaults and validates the event with the default, lenient
+// ValidationOptions. Use NormalizeWith to choose the options.
 func (e *Event) Normalize() error {
-	if e.AnonID == "" && e.LoginID == "" {
-		return ErrEmptyUserIDs
+	return e.NormalizeWith(ValidationOptions{})
+}
+
+// NormalizeWith fills in defaults and validates the event.
+// Event name problems are always errors; property problems are dropped or
+// returned depending on opts.Mode. The property maps are replaced by validated
+// copies, the caller's maps are left as they were.
+func (e *Event) NormalizeWith(opts ValidationOptions) error {
+	normalizeValidationOptions(&opts)
+
+	if err := e.checkSubject(); err != nil {
+		return err
 	}
 
 	// check event name
-	if e.Event == "" {
-		return ErrEventNameEmpty
+	if err := validateEventName(e.Event, opts.Mode); err != nil {
+		return err
+	}
+
+	// check properties
+	props, err := validateProperties("properties", e.Properties, &opts)
+	if err != nil {
+		return err
+	}
+	e.Properties = props
+	e.fillDefaults()
+	if err := limitPropertyCount(e.Properties, &opts); err != nil {
+		return err
+	}
+	if len(e.UserProperties) > 0 {
+		upo := make(UserPropertyOpts, len(e.UserProperties))
+		for op, val := range e.UserProperties {
+			if props, ok := val.(map[string]any); ok {
+				if val, err = validateProperties("user_properties."+op, props, &opts); err != nil {
+					return err
+				}
+			}
+			upo[op] = val
+		}
+		e.UserProperties = upo
+	}
+
+	return nil
+}
+
+// checkSubject checks that the event has a user ID. $GroupSet events are keyed
+// by $group_key and $group_id instead.
+func (e *Event) checkSubject() error {
+	if e.Event == PseGroupSet {
+		key, _ := e.Properties[PspGroupKey].(string)
+		id, _ := e.Properties[PspGroupID].(string)
+		if key == "" || id == "" {
+			return ErrEmptyGroup
+		}
+		return nil
 	}
+	if e.AnonID == "" && e.LoginID == "" {
+		return ErrEmptyUserIDs
+	}
+	return nil
+}
 
+// fillDefaults sets a missing trace ID and time and the $lib properties.
+func (e *Event) fillDefaults() {
 	// check trace id
 	if e.TraceID == "" {
 		e.TraceID = NewUUID()
@@ -115,8 +172,6 @@ func (e *Event) Normalize() error {
 	if _, exists := e.Properties[PspLibVersion]; !exists {
 		e.Properties[PspLibVersion] = version
 	}
-
-	return nil
 }
 
 // Properties contains event properties.
@@ -413,9 +468,46 @@ func (p Properties) City() string {
 // User represents a unified user identity for both A/B testing and event tracking.
 // Use struct literal to create: sensorswave.User{LoginID: "user-123"}
 type User struct {
-	AnonID           string     `json:"anon_id,omitempty"`       // Anonymous or device ID
-	LoginID          string     `json:"login_id,omitempty"`      // Login user ID
-	ABUserProperties Properties `json:"ab_user_props,omitempty"` // Properties for A/B test targeting
+	AnonID           string            `json:"anon_id,omitempty"`       // Anonymous or device ID
+	LoginID          string            `json:"login_id,omitempty"`      // Login user ID
+	ABUserProperties Properties        `json:"ab_user_props,omitempty"` // Properties for A/B test targeting
+	Groups           map[string]string `json:"groups,omitempty"`        // Group memberships by group key, e.g. {"company_id": "42"}
+	CustomIDs        map[string]string `json:"custom_ids,omitempty"`    // Other unit IDs for A/B subjects, e.g. {"device_id": "d-1"}
+}
+
+// WithCustomID adds a custom unit ID, such as WithCustomID("session_id", "s-1").
+// Returns a new User with the ID added (does not modify the original).
+func (u User) WithCustomID(unit, id string) User {
+	ids := make(map[string]string, len(u.CustomIDs)+1)
+	for k, v := range u.CustomIDs {
+		ids[k] = v
+	}
+	ids[unit] = id
+	u.CustomIDs = ids
+	return u
+}
+
+// WithGroup adds a group membership, such as WithGroup("company_id", "42").
+// Returns a new User with the group added (does not modify the original).
+func (u User) WithGroup(groupKey, groupID string) User {
+	groups := make(map[string]string, len(u.Groups)+1)
+	for k, v := range u.Groups {
+		groups[k] = v
+	}
+	groups[groupKey] = groupID
+	u.Groups = groups
+	return u
+}
+
+// groupProperties adds the group memberships of u to properties.
+// Properties already set by the caller win.
+func (u User) groupProperties(properties Properties) Properties {
+	for key, id := range u.Groups {
+		if _, exists := properties[key]; !exists && id != "" {
+			properties[key] = id
+		}
+	}
+	return properties
 }
 
 // WithABUserProperty adds a single A/B testing user property for targeting.
@@ -0,0 +1,297 @@
+package sensorswave
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ValidationMode controls how invalid event fields are handled.
+type ValidationMode int
+
+const (
+	// ValidationLenient drops or coerces properties that are too long, too deep or
+	// can't be encoded, and logs them.
+	ValidationLenient ValidationMode = iota
+	// ValidationStrict rejects the event with a *ValidationError. It also enforces
+	// the event name charset and reserves '$' event names and property keys for
+	// predefined ones.
+	ValidationStrict
+)
+
+// ValidationOptions configures Event.NormalizeWith.
+// Event name problems are returned as errors in both modes.
+type ValidationOptions struct {
+	// Mode selects lenient or strict handling. Default: ValidationLenient
+	Mode ValidationMode
+
+	// MaxPropertyCount is the maximum number of event properties. Default: 1000
+	MaxPropertyCount int
+
+	// MaxDepth is the maximum nesting of lists and maps in a property value. Default: 3
+	MaxDepth int
+
+	// Logger receives the fields dropped in lenient mode. If nil, they are dropped silently.
+	Logger Logger
+}
+
+// validation default
+const (
+	maxEventNameLength      = 128
+	maxPropertyKeyLength    = 128
+	defaultMaxPropertyCount = 1000
+	defaultMaxValueDepth    = 3
+)
+
+// ValidationError describes why an event failed validation.
+type ValidationError struct {
+	Field string // "event", "properties", "user_properties.<operator>" or "group_key"
+	Key   string // offending event name or property key
+	Err   error  // one of the ErrEvent*/ErrProperty* errors
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s %q: %v", e.Field, e.Key, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+var eventNamePattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// predefinedEvents are the only event names allowed to start with '$'.
+var predefinedEvents = map[string]struct{}{
+	PseIdentify:       {},
+	PseFeatureImpress: {},
+	PseExpImpress:     {},
+	PseUserSet:        {},
+	PseGroupSet:       {},
+}
+
+// predefinedProperties are the '$' keys known to the backend.
+var predefinedProperties = map[string]struct{}{
+	PspUserSetType:    {},
+	PspFeatureKey:     {},
+	PspFeatureVariant: {},
+	PspExpKey:         {},
+	PspExpVariant:     {},
+	PspGroupKey:       {},
+	PspGroupID:        {},
+	PspLib:            {},
+	PspLibVersion:     {},
+	PspAppVer:         {},
+	PspBrowser:        {},
+	PspBrowserVer:     {},
+	PspModel:          {},
+	PspIP:             {},
+	PspOS:             {},
+	PspOSVer:          {},
+	PspCountry:        {},
+	PspProvince:       {},
+	PspCity:           {},
+	"$manufacturer":   {},
+	"$wifi":           {},
+	"$screen_width":   {},
+	"$screen_height":  {},
+}
+
+// predefinedPropertyPrefixes cover generated '$' keys such as "$feature_{ID}".
+var predefinedPropertyPrefixes = []string{"$feature_", "$exp_"}
+
+func normalizeValidationOptions(opts *ValidationOptions) {
+	if opts.MaxPropertyCount <= 0 {
+		opts.MaxPropertyCount = defaultMaxPropertyCount
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = defaultMaxValueDepth
+	}
+}
+
+func isPredefinedProperty(key string) bool {
+	if _, ok := predefinedProperties[key]; ok {
+		return true
+	}
+	for _, prefix := range predefinedPropertyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEventName checks the length, and in strict mode the charset and the reserved '$' prefix.
+func validateEventName(name string, mode ValidationMode) error {
+	if name == "" {
+		return ErrEventNameEmpty
+	}
+	if utf8.RuneCountInString(name) > maxEventNameLength {
+		return &ValidationError{Field: "event", Key: name, Err: ErrEventNameTooLong}
+	}
+	if mode != ValidationStrict {
+		return nil
+	}
+	if !eventNamePattern.MatchString(name) {
+		return &ValidationError{Field: "event", Key: name, Err: ErrEventNameInvalid}
+	}
+	if strings.HasPrefix(name, "$") {
+		if _, ok := predefinedEvents[name]; !ok {
+			return &ValidationError{Field: "event", Key: name, Err: ErrEventNameReserved}
+		}
+	}
+	return nil
+}
+
+// validatePropertyKey checks the key length, and in strict mode the reserved '$' prefix.
+func validatePropertyKey(key string, mode ValidationMode) error {
+	if key == "" {
+		return ErrPropertyKeyEmpty
+	}
+	if utf8.RuneCountInString(key) > maxPropertyKeyLength {
+		return ErrPropertyKeyTooLong
+	}
+	if mode == ValidationStrict && strings.HasPrefix(key, "$") && !isPredefinedProperty(key) {
+		return ErrPropertyKeyReserved
+	}
+	return nil
+}
+
+// validateProperties returns a copy of props with every key and value checked.
+// In lenient mode offending entries are left out; in strict mode the first one is returned.
+func validateProperties(field string, props map[string]any, opts *ValidationOptions) (map[string]any, error) {
+	if props == nil {
+		return nil, nil
+	}
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]any, len(props))
+	for _, key := range keys {
+		err := validatePropertyKey(key, opts.Mode)
+		if err == nil {
+			if value, ok := coercePropertyValue(props[key], opts.MaxDepth); ok {
+				out[key] = value
+				continue
+			}
+			err = ErrPropertyValueInvalid
+		}
+
+		verr := &ValidationError{Field: field, Key: key, Err: err}
+		if opts.Mode == ValidationStrict {
+			return nil, verr
+		}
+		if opts.Logger != nil {
+			opts.Logger.Warnf("dropping invalid property: %v", verr)
+		}
+	}
+	return out, nil
+}
+
+// limitPropertyCount enforces MaxPropertyCount in place, keeping predefined '$' keys first.
+// props must be a copy owned by the event, such as the one from validateProperties.
+func limitPropertyCount(props Properties, opts *ValidationOptions) error {
+	if len(props) <= opts.MaxPropertyCount {
+		return nil
+	}
+	if opts.Mode == ValidationStrict {
+		return &ValidationError{Field: "properties", Key: fmt.Sprintf("%d keys", len(props)), Err: ErrTooManyProperties}
+	}
+
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := strings.HasPrefix(keys[i], "$"), strings.HasPrefix(keys[j], "$")
+		if pi != pj {
+			return pi
+		}
+		return keys[i] < keys[j]
+	})
+	dropped := keys[opts.MaxPropertyCount:]
+	for _, key := range dropped {
+		delete(props, key)
+	}
+	if opts.Logger != nil {
+		opts.Logger.Warnf("dropping %d properties over the limit of %d: %v", len(dropped), opts.MaxPropertyCount, dropped)
+	}
+	return nil
+}
+
+// coercePropertyValue returns a JSON and backend compatible form of v, or false if there is none.
+func coercePropertyValue(v any, depth int) (any, bool) {
+	switch val := v.(type) {
+	case nil, bool, string, json.Number,
+		int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64:
+		return v, true
+	case float64:
+		return v, !math.IsNaN(val) && !math.IsInf(val, 0)
+	case float32:
+		return v, !math.IsNaN(float64(val)) && !math.IsInf(float64(val), 0)
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano), true
+	case json.Marshaler:
+		_, err := json.Marshal(val)
+		return v, err == nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil, true
+		}
+		return coercePropertyValue(rv.Elem().Interface(), depth)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return v, true
+		}
+		if depth <= 0 {
+			return nil, false
+		}
+		out := make([]any, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			elem, ok := coercePropertyValue(rv.Index(i).Interface(), depth-1)
+			if !ok {
+				return nil, false
+			}
+			out[i] = elem
+		}
+		return out, true
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String || depth <= 0 {
+			return nil, false
+		}
+		out := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			elem, ok := coercePropertyValue(iter.Value().Interface(), depth-1)
+			if !ok {
+				return nil, false
+			}
+			out[iter.Key().String()] = elem
+		}
+		return out, true
+	case reflect.Struct:
+		_, err := json.Marshal(v)
+		return v, err == nil
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v, true // named basic types
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		return v, !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+	return nil, false // chan, func, complex, unsafe pointer, ...
+}
@@ -0,0 +1,120 @@
+package sensorswave
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateEventName(t *testing.T) {
+	strict := ValidationStrict
+	require.NoError(t, validateEventName("PageView", strict))
+	require.NoError(t, validateEventName("$Identify", strict))
+	require.ErrorIs(t, validateEventName("", strict), ErrEventNameEmpty)
+	require.ErrorIs(t, validateEventName(strings.Repeat("a", 129), strict), ErrEventNameTooLong)
+	require.ErrorIs(t, validateEventName("page view", strict), ErrEventNameInvalid)
+	require.ErrorIs(t, validateEventName("1st_visit", strict), ErrEventNameInvalid)
+	require.ErrorIs(t, validateEventName("$Custom", strict), ErrEventNameReserved)
+
+	lenient := ValidationLenient
+	for _, name := range []string{"page-view", "order.created", "页面浏览", "$page_view"} {
+		require.NoError(t, validateEventName(name, lenient), name)
+	}
+	require.ErrorIs(t, validateEventName("", lenient), ErrEventNameEmpty)
+	require.ErrorIs(t, validateEventName(strings.Repeat("a", 129), lenient), ErrEventNameTooLong)
+}
+
+func TestNormalizeValidatesWithDefaults(t *testing.T) {
+	props := Properties{"$referrer": "x", "ch": make(chan int)}
+	event := NewEvent("anon", "", "order.created").WithProperties(props)
+	require.NoError(t, event.Normalize())
+	require.NotEmpty(t, event.TraceID)
+	require.NotZero(t, event.Time)
+	require.Equal(t, sdkType, event.Properties[PspLib])
+	require.Contains(t, event.Properties, "$referrer")
+	require.NotContains(t, event.Properties, "ch")
+	require.Len(t, props, 2, "the caller's map is left as it was")
+
+	noName, noUser := NewEvent("anon", "", ""), NewEvent("", "", "A")
+	require.ErrorIs(t, noName.Normalize(), ErrEventNameEmpty)
+	require.ErrorIs(t, noUser.Normalize(), ErrEmptyUserIDs)
+	longName := NewEvent("anon", "", strings.Repeat("e", 129))
+	require.ErrorIs(t, longName.Normalize(), ErrEventNameTooLong)
+}
+
+func TestNormalizeWithCopiesPropertyMaps(t *testing.T) {
+	props := Properties{"when": time.Unix(0, 0), "ch": make(chan int)}
+	set := map[string]any{"fn": func() {}, "name": "x"}
+	event := NewEvent("anon", "", "Checked").WithProperties(props).
+		WithUserPropertyOpts(UserPropertyOpts{"$set": set})
+	require.NoError(t, event.NormalizeWith(ValidationOptions{}))
+
+	require.Equal(t, "1970-01-01T00:00:00Z", event.Properties["when"])
+	require.Equal(t, map[string]any{"name": "x"}, event.UserProperties["$set"])
+	require.IsType(t, time.Time{}, props["when"])
+	require.Contains(t, props, "ch")
+	require.NotContains(t, props, PspLib)
+	require.Contains(t, set, "fn")
+}
+
+func TestNormalizeLenientDropsInvalidProperties(t *testing.T) {
+	ts := time.Date(2026, 1, 2, 11, 4, 5, 0, time.FixedZone("CST", 8*3600))
+	event := NewEvent("anon", "", "Checked").WithProperties(Properties{
+		"ok":                     "value",
+		"list":                   []string{"a", "b"},
+		"when":                   ts,
+		"nan":                    math.NaN(),
+		"ch":                     make(chan int),
+		"fn":                     func() {},
+		"deep":                   map[string]any{"a": map[string]any{"b": map[string]any{"c": map[string]any{"d": 1}}}},
+		"$referrer":              "https://example.com",
+		PspAppVer:                "1.0",
+		"$feature_12":            "on",
+		strings.Repeat("k", 129): 1,
+	})
+
+	require.NoError(t, event.NormalizeWith(ValidationOptions{Logger: &noopLogger{}}))
+	require.Equal(t, "value", event.Properties["ok"])
+	require.Equal(t, []any{"a", "b"}, event.Properties["list"])
+	require.Equal(t, "2026-01-02T03:04:05Z", event.Properties["when"])
+	require.Equal(t, "https://example.com", event.Properties["$referrer"], "'$' keys are only reserved in strict mode")
+	require.Equal(t, "1.0", event.Properties[PspAppVer])
+	require.Equal(t, "on", event.Properties["$feature_12"])
+	for _, key := range []string{"nan", "ch", "fn", "deep", strings.Repeat("k", 129)} {
+		require.NotContains(t, event.Properties, key)
+	}
+}
+
+func TestNormalizeStrictReturnsTypedErrors(t *testing.T) {
+	strict := ValidationOptions{Mode: ValidationStrict}
+
+	event := NewEvent("anon", "", "Checked").WithProperties(Properties{"$custom": 1})
+	err := event.NormalizeWith(strict)
+	require.ErrorIs(t, err, ErrPropertyKeyReserved)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "properties", verr.Field)
+	require.Equal(t, "$custom", verr.Key)
+
+	event = NewEvent("anon", "", "Checked").WithProperties(Properties{"inf": math.Inf(1)})
+	require.ErrorIs(t, event.NormalizeWith(strict), ErrPropertyValueInvalid)
+
+	event = NewEvent("anon", "", "Checked").WithUserPropertyOpts(NewUserPropertyOpts().Set(strings.Repeat("k", 129), 1))
+	require.ErrorIs(t, event.NormalizeWith(strict), ErrPropertyKeyTooLong)
+
+	event = NewEvent("anon", "", "Checked").WithProperties(Properties{"a": 1, "b": 2})
+	require.ErrorIs(t, event.NormalizeWith(ValidationOptions{Mode: ValidationStrict, MaxPropertyCount: 3}), ErrTooManyProperties)
+}
+
+func TestNormalizeLenientLimitsPropertyCount(t *testing.T) {
+	event := NewEvent("anon", "", "Checked").WithProperties(Properties{"a": 1, "b": 2, "c": 3})
+	require.NoError(t, event.NormalizeWith(ValidationOptions{MaxPropertyCount: 4}))
+	require.Len(t, event.Properties, 4)
+	require.Contains(t, event.Properties, PspLib)
+	require.Contains(t, event.Properties, PspLibVersion)
+	require.Contains(t, event.Properties, "a")
+	require.Contains(t, event.Properties, "b")
+}
@@ -0,0 +1,189 @@
+package sensorswave
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretLookup returns the project secret for a source token, or false if the token is unknown.
+type SecretLookup func(sourceToken string) (projectSecret string, ok bool)
+
+// NonceCache remembers the nonces of verified requests to reject replays.
+type NonceCache interface {
+	// CheckAndStore records nonce for ttl and reports whether it was already recorded.
+	CheckAndStore(nonce string, ttl time.Duration) (seen bool)
+}
+
+// MemoryNonceCache is an in-process NonceCache. Expired nonces are swept as new ones are stored.
+type MemoryNonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	nextSweep time.Time
+}
+
+var _ NonceCache = (*MemoryNonceCache)(nil)
+
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{expires: make(map[string]time.Time)}
+}
+
+func (m *MemoryNonceCache) CheckAndStore(nonce string, ttl time.Duration) bool {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.After(m.nextSweep) {
+		for k, exp := range m.expires {
+			if now.After(exp) {
+				delete(m.expires, k)
+			}
+		}
+		m.nextSweep = now.Add(ttl)
+	}
+	if exp, ok := m.expires[nonce]; ok && !now.After(exp) {
+		return true
+	}
+	m.expires[nonce] = now.Add(ttl)
+	return false
+}
+
+const (
+	// defaultMaxSkew is the default allowed difference between x-auth-timestamp and the local clock.
+	defaultMaxSkew = 5 * time.Minute
+	// defaultMaxBodyBytes is the default limit of a verified request body, twice the SDK's batch limit.
+	defaultMaxBodyBytes = 2 * maxHTTPBodySize
+)
+
+// Verifier checks ACS3-HMAC-SHA256 signed requests produced by SignRequest.
+type Verifier struct {
+	Secrets      SecretLookup  // required
+	MaxSkew      time.Duration // default 5m
+	Nonces       NonceCache    // if nil, nonces are not checked for replay
+	MaxBodyBytes int64         // default 10MB, larger bodies fail with ErrBodyTooLarge
+}
+
+var defaultVerifier = &Verifier{Nonces: NewMemoryNonceCache()}
+
+// VerifyRequest verifies a request signed by SignRequest, with a 5 minute timestamp
+// skew and an in-process nonce cache shared by all calls. It returns the source token
+// the request was signed for. r.Body is read and replaced, so handlers can still read it.
+func VerifyRequest(r *http.Request, lookup SecretLookup) (sourceToken string, err error) {
+	v := *defaultVerifier
+	v.Secrets = lookup
+	return v.Verify(r)
+}
+
+// Verify checks r's body size, signature, body hash, timestamp and nonce, in that order.
+// It returns the source token the request was signed for.
+func (v *Verifier) Verify(r *http.Request) (sourceToken string, err error) {
+	maxBody := v.MaxBodyBytes
+	if maxBody <= 0 {
+		maxBody = defaultMaxBodyBytes
+	}
+	if r.ContentLength > maxBody {
+		return "", ErrBodyTooLarge
+	}
+
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return "", ErrSignatureMissing
+	}
+	sourceToken, signedHeaders, signature, err := parseAuthorization(auth)
+	if err != nil {
+		return "", err
+	}
+	secret, ok := v.Secrets(sourceToken)
+	if !ok {
+		return sourceToken, ErrUnknownCredential
+	}
+
+	// Signing headers must be covered by the signature
+	headers := make(map[string]string, len(signedHeaders))
+	for _, key := range signedHeaders {
+		headers[key] = r.Header.Get(key)
+	}
+	for _, key := range []string{"x-content-sha256", "x-auth-timestamp", "x-auth-nonce"} {
+		if headers[key] == "" {
+			return sourceToken, fmt.Errorf("%w: %s is not signed", ErrSignatureMalformed, key)
+		}
+	}
+
+	canonicalRequest := buildCanonicalRequest(r.Method, r.URL.EscapedPath(), r.URL.RawQuery, headers, headers["x-content-sha256"])
+	stringToSign := fmt.Sprintf("%s\n%s", SignatureAlgorithm, sha256Hex([]byte(canonicalRequest)))
+	expected := hmacSHA256Hex(secret, stringToSign)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return sourceToken, ErrSignatureInvalid
+	}
+
+	var body []byte
+	if r.Body != nil {
+		// Content-Length may be absent or wrong, so the read is limited as well
+		if body, err = io.ReadAll(io.LimitReader(r.Body, maxBody+1)); err != nil {
+			return sourceToken, err
+		}
+		r.Body.Close()
+		if int64(len(body)) > maxBody {
+			return sourceToken, ErrBodyTooLarge
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if sha256Hex(body) != headers["x-content-sha256"] {
+		return sourceToken, ErrBodyHashMismatch
+	}
+
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxSkew
+	}
+	ms, err := strconv.ParseInt(headers["x-auth-timestamp"], 10, 64)
+	if err != nil {
+		return sourceToken, fmt.Errorf("%w: x-auth-timestamp: %v", ErrSignatureMalformed, err)
+	}
+	if skew := time.Since(time.UnixMilli(ms)); skew > maxSkew || skew < -maxSkew {
+		return sourceToken, ErrTimestampSkew
+	}
+
+	// A replay outside the skew window is already rejected above
+	if v.Nonces != nil && v.Nonces.CheckAndStore(sourceToken+":"+headers["x-auth-nonce"], 2*maxSkew) {
+		return sourceToken, ErrNonceReplayed
+	}
+	return sourceToken, nil
+}
+
+// parseAuthorization splits "ACS3-HMAC-SHA256 Credential=...,SignedHeaders=...,Signature=...".
+func parseAuthorization(auth string) (credential string, signedHeaders []string, signature string, err error) {
+	params, ok := strings.CutPrefix(auth, SignatureAlgorithm+" ")
+	if !ok {
+		return "", nil, "", fmt.Errorf("%w: unsupported algorithm", ErrSignatureMalformed)
+	}
+
+	var signedHeadersStr string
+	for _, part := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "Credential":
+			credential = value
+		case "SignedHeaders":
+			signedHeadersStr = value
+		case "Signature":
+			signature = value
+		}
+	}
+	if credential == "" || signedHeadersStr == "" || signature == "" {
+		return "", nil, "", fmt.Errorf("%w: missing Credential, SignedHeaders or Signature", ErrSignatureMalformed)
+	}
+
+	signedHeaders = strings.Split(strings.ToLower(signedHeadersStr), ";")
+	if !sort.StringsAreSorted(signedHeaders) {
+		return "", nil, "", fmt.Errorf("%w: SignedHeaders is not sorted", ErrSignatureMalformed)
+	}
+	return credential, signedHeaders, signature, nil
+}
@@ -0,0 +1,122 @@
+package sensorswave
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedRequest(body []byte, headers map[string]string) *http.Request {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers["Content-Type"] = "application/json"
+	headers[HeaderSourceToken] = "test-token"
+	SignRequest("POST", "/in/track", "", headers, body, "test-token", "test-secret")
+
+	r := httptest.NewRequest("POST", "http://example.com/in/track", bytes.NewReader(body))
+	for k, v := range headers {
+		r.Header.Set(k, v)
+	}
+	return r
+}
+
+func testSecrets(token string) (string, bool) {
+	return "test-secret", token == "test-token"
+}
+
+func TestVerifyRequest(t *testing.T) {
+	body := []byte(`[{"event":"Signed"}]`)
+	r := newSignedRequest(body, nil)
+
+	token, err := VerifyRequest(r, testSecrets)
+	require.NoError(t, err)
+	require.Equal(t, "test-token", token)
+
+	// The body is still readable by the handler
+	got, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, got)
+}
+
+func TestVerifyRequestRejects(t *testing.T) {
+	body := []byte(`[{"event":"Signed"}]`)
+	v := &Verifier{Secrets: testSecrets, MaxSkew: time.Minute, Nonces: NewMemoryNonceCache()}
+
+	r := newSignedRequest(body, nil)
+	r.Header.Del("Authorization")
+	_, err := v.Verify(r)
+	require.ErrorIs(t, err, ErrSignatureMissing)
+
+	r = newSignedRequest(body, nil)
+	r.Header.Set("Authorization", "Basic abc")
+	_, err = v.Verify(r)
+	require.ErrorIs(t, err, ErrSignatureMalformed)
+
+	_, err = v.Verify(newSignedRequest(body, nil))
+	require.NoError(t, err)
+	_, err = (&Verifier{Secrets: func(string) (string, bool) { return "", false }}).Verify(newSignedRequest(body, nil))
+	require.ErrorIs(t, err, ErrUnknownCredential)
+	_, err = (&Verifier{Secrets: func(string) (string, bool) { return "other-secret", true }}).Verify(newSignedRequest(body, nil))
+	require.ErrorIs(t, err, ErrSignatureInvalid)
+
+	// Body changed after signing
+	r = newSignedRequest(body, nil)
+	r.Body = io.NopCloser(bytes.NewReader([]byte(`[{"event":"Tampered"}]`)))
+	_, err = v.Verify(r)
+	require.ErrorIs(t, err, ErrBodyHashMismatch)
+
+	// Signed header changed after signing
+	r = newSignedRequest(body, nil)
+	r.Header.Set(HeaderSourceToken, "other-token")
+	_, err = v.Verify(r)
+	require.ErrorIs(t, err, ErrSignatureInvalid)
+
+	old := strconv.FormatInt(time.Now().Add(-2*time.Minute).UnixMilli(), 10)
+	_, err = v.Verify(newSignedRequest(body, map[string]string{"x-auth-timestamp": old}))
+	require.ErrorIs(t, err, ErrTimestampSkew)
+
+	headers := map[string]string{"x-auth-nonce": "fixed-nonce"}
+	_, err = v.Verify(newSignedRequest(body, headers))
+	require.NoError(t, err)
+	_, err = v.Verify(newSignedRequest(body, map[string]string{"x-auth-nonce": "fixed-nonce"}))
+	require.ErrorIs(t, err, ErrNonceReplayed)
+}
+
+func TestVerifyRejectsLargeBodies(t *testing.T) {
+	body := []byte(`[{"event":"Signed"}]`)
+	v := &Verifier{Secrets: testSecrets, MaxBodyBytes: int64(len(body))}
+
+	_, err := v.Verify(newSignedRequest(body, nil))
+	require.NoError(t, err)
+
+	big := append(body, ' ')
+	_, err = v.Verify(newSignedRequest(big, nil))
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+
+	// A request without Content-Length is still limited while reading
+	r := newSignedRequest(big, nil)
+	r.ContentLength = -1
+	_, err = v.Verify(r)
+	require.ErrorIs(t, err, ErrBodyTooLarge)
+}
+
+func TestMemoryNonceCacheExpires(t *testing.T) {
+	cache := NewMemoryNonceCache()
+	require.False(t, cache.CheckAndStore("a", 10*time.Millisecond))
+	require.True(t, cache.CheckAndStore("a", 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	require.False(t, cache.CheckAndStore("a", 10*time.Millisecond))
+}
+
+func TestGenerateNonceIsRandom(t *testing.T) {
+	a, b := generateNonce(), generateNonce()
+	require.Len(t, a, 32)
+	require.NotEqual(t, a, b)
+}